@@ -4,9 +4,16 @@ import (
 	"flag"
 	"fmt"
 	"joviandss-kubernetescsi/pkg/common"
+	"joviandss-kubernetescsi/pkg/identity"
+	"joviandss-kubernetescsi/pkg/metrics"
 	"joviandss-kubernetescsi/pkg/pluginserver"
-
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	//"joviandss-kubernetescsi/pkg/joviandss"
@@ -30,10 +37,18 @@ var (
 	netType         string
 	configPath      string
 	logLevel        string
+	logFormat       string
 	logPath         string
 	startController bool
 	startNode       bool
 	startIdentity   bool
+	httpAddress     string
+	shutdownTimeout time.Duration
+	reloadInterval  time.Duration
+
+	listenerCfg    pluginserver.ListenerCfg
+	allowedClients string
+	socketMode     string
 )
 
 func main() {
@@ -43,9 +58,16 @@ func main() {
 	// TODO: check if logging parametrs a properly parse
 	var l *logrus.Entry
 	if cfg != nil {
-		l = initLogging(cfg.LLevel, cfg.LDest)
+		format := cfg.LFormat
+		if len(format) == 0 {
+			format = logFormat
+		}
+		l = initLogging(cfg.LLevel, format, cfg.LDest)
+		for _, d := range cfg.Deprecations() {
+			l.Warn(d)
+		}
 	} else {
-		l = initLogging(logLevel, logPath)
+		l = initLogging(logLevel, logFormat, logPath)
 	}
 	l.Debugf("Version %s", common.Version)
 
@@ -53,14 +75,14 @@ func main() {
 	os.Exit(0)
 }
 
-func initLogging(logLevel string, toFile string) *logrus.Entry {
+func initLogging(logLevel string, logFormat string, toFile string) *logrus.Entry {
 	log := logrus.New()
-	formater := logrus.TextFormatter{
-
-		DisableColors: false,
-		FullTimestamp: true,
+	formater, err := common.NewFormatter(logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LogFormat processing error: %s\n", err.Error())
+		os.Exit(1)
 	}
-	log.SetFormatter(&formater)
+	log.SetFormatter(formater)
 
 	if len(toFile) > 0 {
 		file, err := os.OpenFile(toFile, os.O_CREATE|os.O_WRONLY, 0o640)
@@ -85,6 +107,7 @@ func initLogging(logLevel string, toFile string) *logrus.Entry {
 	l := log.WithFields(logrus.Fields{
 		"section": "main",
 	})
+	common.SetDefaultLogger(l)
 
 	return l
 }
@@ -100,13 +123,37 @@ func handleArgs() *common.JovianDSSCfg {
 	flag.StringVar(&common.NodeID, "nodeid", "", "Id of the kubernetes node")
 	flag.StringVar(&configPath, "config", "", "Path to configuration file")
 	flag.StringVar(&logLevel, "loglevel", "WARNING", "Log Level, default is Warning")
+	flag.StringVar(&logFormat, "logformat", common.LogFormatText, "Log format, text or json")
 	flag.StringVar(&logPath, "logpath", "", "Log file location")
+	flag.StringVar(&listenerCfg.TLSCert, "tls-cert", "", "Path to PEM encoded certificate to serve CSI endpoint over TLS, tcp socket only")
+	flag.StringVar(&listenerCfg.TLSKey, "tls-key", "", "Path to PEM encoded key of TLS certificate")
+	flag.StringVar(&listenerCfg.ClientCA, "tls-client-ca", "", "Path to PEM encoded CA certificates, if set clients have to present certificate signed by them")
+	flag.StringVar(&allowedClients, "allowed-clients", "", "Comma separated list of client certificate names allowed to call plugin, any verified client is allowed if empty")
+	flag.StringVar(&socketMode, "socket-mode", "", "Permissions of unix socket in octal form, for instance 0660")
+	flag.StringVar(&listenerCfg.SocketOwner, "socket-owner", "", "Owner of unix socket in user:group form")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 25*time.Second, "Time to wait for requests being served to complete on SIGTERM before interrupting them")
+	flag.DurationVar(&reloadInterval, "config-reload-interval", 30*time.Second, "How often config file is checked for changes to reload controller configuration, disabled if 0")
+	flag.StringVar(&httpAddress, "http-address", "", "Address to serve metrics and health checks on, for instance :9810, disabled if empty")
 	flag.Parse()
 
+	for _, c := range strings.Split(allowedClients, ",") {
+		if c = strings.TrimSpace(c); len(c) > 0 {
+			listenerCfg.AllowedClients = append(listenerCfg.AllowedClients, c)
+		}
+	}
+	if len(socketMode) > 0 {
+		mode, err := strconv.ParseUint(socketMode, 8, 32)
+		if err != nil || mode > 0o777 {
+			fmt.Fprintf(os.Stderr, "Incorrect socket mode %s\n", socketMode)
+			os.Exit(1)
+		}
+		listenerCfg.SocketMode = os.FileMode(mode)
+	}
+
 	if len(configPath) > 0 {
 		var cfg common.JovianDSSCfg
 		if err := common.SetupConfig(configPath, &cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "Unable to process config: %s", err.Error())
+			fmt.Fprintf(os.Stderr, "Unable to process config: %s\n", err.Error())
 			os.Exit(1)
 		}
 		return &cfg
@@ -116,7 +163,55 @@ func handleArgs() *common.JovianDSSCfg {
 
 func routine(cfg *common.JovianDSSCfg, l *logrus.Entry) {
 	l.Debug("Start app")
-	jdss, _ := pluginserver.GetPluginServer(cfg, l, &netType, &address, startController, startNode, startIdentity)
+	jdss, err := pluginserver.GetPluginServer(cfg, l, &netType, &address, &listenerCfg, startController, startNode, startIdentity)
+	if err != nil {
+		l.Errorf("Unable to start plugin server: %s", err)
+		os.Exit(1)
+	}
+
+	if len(httpAddress) > 0 {
+		go serveHTTP(httpAddress, jdss, l)
+	}
+
+	if len(configPath) > 0 && reloadInterval > 0 {
+		jdss.WatchConfig(configPath, reloadInterval)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- jdss.Run()
+	}()
+
+	select {
+	case sig := <-stop:
+		l.Infof("Got %s signal", sig)
+		jdss.Shutdown(shutdownTimeout)
+		<-done
+	case err := <-done:
+		if err != nil {
+			os.Exit(1)
+		}
+	}
+}
 
-	jdss.Run()
+// serveHTTP exposes Prometheus metrics on /metrics, liveness on /healthz and readiness on /readyz
+func serveHTTP(addr string, jdss *pluginserver.PluginServer, l *logrus.Entry) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/healthz", identity.LivenessHandler())
+	mux.Handle("/readyz", jdss.Readiness().ReadinessHandler())
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	l.Infof("Serving metrics and health checks on %s", addr)
+	if err := srv.ListenAndServe(); err != nil {
+		l.Errorf("HTTP listener failed: %s", err)
+	}
 }
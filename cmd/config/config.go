@@ -0,0 +1,75 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	jcom "joviandss-kubernetescsi/pkg/common"
+)
+
+// ConfigCmd groups commands that work with plugin config file
+var ConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Set of commands associated with plugin config file",
+}
+
+// ValidateCmd checks config file the same way plugin does on start
+var ValidateCmd = &cobra.Command{
+	Use:   "validate <config file>",
+	Short: "Validate config file",
+	Long: `Reads config file the same way plugin does on start.
+
+	Unknown properties are rejected, JDSS_* environment variables override
+	values from the file and defaults are applied before config is validated.
+	All problems found are reported, command exits with non zero code if there are any.`,
+	Args: cobra.ExactArgs(1),
+	Run:  validateConfig,
+}
+
+func validateConfig(cmd *cobra.Command, args []string) {
+	var cfg jcom.JovianDSSCfg
+
+	err := jcom.SetupConfig(args[0], &cfg)
+	if err == nil {
+		for _, d := range cfg.Deprecations() {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", d)
+		}
+		fmt.Printf("Config %s is valid\n", args[0])
+		return
+	}
+
+	var cErr *jcom.ConfigError
+	if errors.As(err, &cErr) {
+		fmt.Fprintf(os.Stderr, "Config %s is invalid:\n", args[0])
+		for _, p := range cErr.Problems {
+			fmt.Fprintf(os.Stderr, "  - %s\n", p)
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Unable to read config %s: %s\n", args[0], err)
+	}
+	os.Exit(1)
+}
+
+func init() {
+	ConfigCmd.AddCommand(ValidateCmd)
+}
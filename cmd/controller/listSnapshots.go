@@ -71,7 +71,11 @@ func listSnapshots(cmd *cobra.Command, args []string) {
 
 	fmt.Printf("Got resp of size %d %+v\n", len(resp.Entries), resp)
 	for i := 0; i < len(resp.Entries); i++ {
-		fmt.Printf("%d snapshot %s volume %s\n", i, resp.Entries[i].Snapshot.SnapshotId, resp.Entries[i].Snapshot.SourceVolumeId)
+		md, err := cp.SnapshotMetadata(ctx, resp.Entries[i].Snapshot.SnapshotId)
+		if err != nil {
+			logrus.Warnf("Unable to get metadata of snapshot %s: %s", resp.Entries[i].Snapshot.SnapshotId, err.Error())
+		}
+		fmt.Printf("%d snapshot %s volume %s %s\n", i, resp.Entries[i].Snapshot.SnapshotId, resp.Entries[i].Snapshot.SourceVolumeId, md)
 	}
 
 	// var vols []csi_rest.Volume
@@ -10,6 +10,7 @@ import (
 	cli_common "joviandss-kubernetescsi/pkg/common"
 	csi_common "joviandss-kubernetescsi/pkg/common"
 	csi_controller "joviandss-kubernetescsi/pkg/controller"
+	csi_driver "joviandss-kubernetescsi/pkg/driver"
 
 	// csi_rest "joviandss-kubernetescsi/pkg/rest"
 
@@ -58,7 +59,8 @@ func listVolumes(cmd *cobra.Command, args []string) {
 
 	fmt.Printf("Got resp of size %d %+v\n", len(resp.Entries), resp)
 	for i := 0; i < len(resp.Entries); i++ {
-		fmt.Printf("volume %s\n", resp.Entries[i].Volume.VolumeId)
+		fmt.Printf("volume %s %s\n", resp.Entries[i].Volume.VolumeId,
+			csi_driver.Metadata(resp.Entries[i].Volume.VolumeContext))
 	}
 
 	// var vols []csi_rest.Volume
@@ -53,7 +53,7 @@ func stageVolume(cmd *cobra.Command, args []string) {
 
 	// var np csi_node.NodePlugin
 
-	logger, err := cli_common.GetLogger(csi_common.LogLevel, csi_common.LogPath)
+	logger, err := cli_common.GetLogger(csi_common.LogLevel, csi_common.LogFormat, csi_common.LogPath)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Unable to init loging because:", err.Error())
 		os.Exit(1)
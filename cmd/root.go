@@ -6,6 +6,7 @@ package cmd
 
 import (
 	"os"
+	"joviandss-kubernetescsi/cmd/config"
 	"joviandss-kubernetescsi/cmd/controller"
 	"joviandss-kubernetescsi/cmd/node"
 	"github.com/spf13/cobra"
@@ -46,6 +47,7 @@ var (
 func addSubCmds() {
 	rootCmd.AddCommand(node.NodeCmd)
 	rootCmd.AddCommand(controller.ControllerCmd)
+	rootCmd.AddCommand(config.ConfigCmd)
 }
 
 func init() {
@@ -59,6 +61,7 @@ func init() {
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	rootCmd.PersistentFlags().StringVarP(&jcom.LogLevel, "loglevel", "l", "INFO", "Level of logging")
+	rootCmd.PersistentFlags().StringVar(&jcom.LogFormat, "logformat", jcom.LogFormatText, "Format of log output, text or json")
 	rootCmd.PersistentFlags().StringVar(&jcom.LogPath, "logpath", "", "File to store log information")
 
 	addSubCmds()
@@ -6,8 +6,6 @@ import (
 	"os"
 	"strings"
 
-	"gopkg.in/yaml.v3"
-
 	// "joviandss-kubernetescsi/pkg/rest"
 	uuid "github.com/google/uuid"
 
@@ -17,10 +15,11 @@ import (
 
 // Version of plugin, should be filed during compilation
 var (
-	Version  string
-	NodeID   string
-	LogLevel string
-	LogPath  string
+	Version   string
+	NodeID    string
+	LogLevel  string
+	LogFormat string
+	LogPath   string
 )
 
 // Plugin name
@@ -38,44 +37,79 @@ var (
 )
 
 type RestEndpointCfg struct {
-	Addrs       []string `json:"addrs,omitempty"`
-	Port        int      `json:"port,omitempty"`
-	Prot        string   `json:"prot,omitempty"`
-	User        string   `json:"user,omitempty"`
-	Pass        string   `json:"pass,omitempty"`
-	IdleTimeOut string   `json:"idletimeout,omitempty"`
-	Tries       int      `json:"tries,omitempty"`
+	Addrs       []string   `json:"addrs,omitempty" yaml:"addrs"`
+	Port        int        `json:"port,omitempty" yaml:"port"`
+	Prot        string     `json:"prot,omitempty" yaml:"prot"`
+	User        string     `json:"user,omitempty" yaml:"user"`
+	Pass        string     `json:"pass,omitempty" yaml:"pass"`
+	IdleTimeOut string     `json:"idletimeout,omitempty" yaml:"idletimeout"`
+	Tries       int        `json:"tries,omitempty" yaml:"tries"`
+	TLS         RestTLSCfg `json:"tls,omitempty" yaml:"tls"`
+
+	// Properties of older config files, they are accepted with deprecation warning
+	Name string `json:"-" yaml:"name"` // name of storage, it never affected anything
+	Pool string `json:"-" yaml:"pool"` // replaced by top level pool
+}
+
+// RestTLSCfg stores properties of TLS connection to REST endpoint
+type RestTLSCfg struct {
+	CABundle   string   `json:"cabundle,omitempty" yaml:"cabundle"`     // path to PEM encoded CA certificates, system roots are used if empty
+	ServerName string   `json:"servername,omitempty" yaml:"servername"` // name expected in server certificate, if it differs from address
+	ClientCert string   `json:"clientcert,omitempty" yaml:"clientcert"` // path to PEM encoded client certificate for mutual TLS
+	ClientKey  string   `json:"clientkey,omitempty" yaml:"clientkey"`   // path to PEM encoded client key for mutual TLS
+	Pins       []string `json:"pins,omitempty" yaml:"pins"`             // base64 encoded sha256 hashes of SubjectPublicKeyInfo
+	Insecure   bool     `json:"insecure,omitempty" yaml:"insecure"`     // skip server certificate verification
 }
 
 type ISCSIEndpointCfg struct {
-	Vnamelen int      `json:"namelen,omitempty"`
-	Vpasslen int      `json:"passlen,omitempty"`
-	Iqn      string   `json:"iqn,omitempty"`
-	Addrs    []string `json:"addrs,omitempty"`
-	Port     int      `json:"port,omitempty"`
+	Vnamelen int      `json:"namelen,omitempty" yaml:"namelen"`
+	Vpasslen int      `json:"passlen,omitempty" yaml:"passlen"`
+	Iqn      string   `json:"iqn,omitempty" yaml:"iqn"`
+	Addrs    []string `json:"addrs,omitempty" yaml:"addrs"`
+	Port     int      `json:"port,omitempty" yaml:"port"`
+}
+
+// GCCfg stores properties of garbage collector that cleans leftovers of failed operations
+type GCCfg struct {
+	Enabled     bool   `json:"enabled,omitempty" yaml:"enabled"`
+	Interval    string `json:"interval,omitempty" yaml:"interval"`       // See time Duration
+	GracePeriod string `json:"graceperiod,omitempty" yaml:"graceperiod"` // See time Duration
+	DryRun      bool   `json:"dryrun,omitempty" yaml:"dryrun"`
+}
+
+// NamingCfg stores properties that define how volumes are named on the storage
+type NamingCfg struct {
+	Cluster  string `json:"cluster,omitempty" yaml:"cluster"`   // id of the cluster, used to distinguish clusters that share pool
+	Template string `json:"template,omitempty" yaml:"template"` // template of volume name, for instance {{cluster}}-{{namespace}}-{{pvc}}
+	Parent   string `json:"parent,omitempty" yaml:"parent"`     // dataset to place volumes in, volumes are grouped by namespace inside of it
 }
 
 // ControllerCfg stores configaration properties of controller instance
 type JovianDSSCfg struct {
-	LLevel string `yaml:"loglevel"`
-	LDest  string `yaml:"logfile"`
-	Pool   string `yaml:"pool"`
+	LLevel  string `yaml:"loglevel"`
+	LDest   string `yaml:"logfile"`
+	LPath   string `yaml:"logpath"`   // same as logfile, kept for configs that use this name
+	LFormat string `yaml:"logformat"` // text or json
+	Pool    string `yaml:"pool"`
 
 	RestEndpointCfg  RestEndpointCfg  `yaml:"endpoint"`
 	ISCSIEndpointCfg ISCSIEndpointCfg `yaml:"iscsi"`
+	GCCfg            GCCfg            `yaml:"gc"`
+	NamingCfg        NamingCfg        `yaml:"naming"`
 }
 
-func GetLogger(logLevel string, toFile string) (*logrus.Logger, error) {
+// GetLogger creates logger of given level and format, logs are written to file if toFile is not empty
+func GetLogger(logLevel string, logFormat string, toFile string) (*logrus.Logger, error) {
 	log := logrus.New()
 
 	// fmt.Printf("Getting logger with loglevel %s and logfile path %s", logLevel, toFile)
 
-	formater := logrus.TextFormatter{
-
-		DisableColors: false,
-		FullTimestamp: true,
+	formater, err := NewFormatter(logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LogFormat processing error: %s\n", err.Error())
+		return nil, err
 	}
-	logrus.SetFormatter(&formater)
+	log.SetFormatter(formater)
 
 	if len(toFile) > 0 {
 		file, err := os.OpenFile(toFile, os.O_CREATE|os.O_WRONLY, 0o640)
@@ -133,7 +167,7 @@ func GetLogger(logLevel string, toFile string) (*logrus.Logger, error) {
 // 	return nil
 // }
 
-// GetConfing reads Config from config file
+// SetupConfig reads and validates Config from config file
 func SetupConfig(path string, c *JovianDSSCfg) error {
 	// var c JovianDSSCfg
 	source, err := os.ReadFile(path)
@@ -141,49 +175,79 @@ func SetupConfig(path string, c *JovianDSSCfg) error {
 		return err
 	}
 
-	err = yaml.Unmarshal(source, &c)
-	if err != nil {
-		return err
-	}
-	return nil
+	return ParseConfig(source, c)
 }
 
 type JDSSLoggerContextID int
 
-const loggerKey JDSSLoggerContextID = iota
+const (
+	loggerKey JDSSLoggerContextID = iota
+	traceIDKey
+)
 
-func WithLogger(ctx context.Context, logger *logrus.Entry) context.Context {
+// RequestIDHeader is a name of gRPC metadata key and HTTP header that carries trace ID of request
+const RequestIDHeader = "X-Request-ID"
 
-	var traceId string
+// WithTraceID stores trace ID that identifies request in context
+func WithTraceID(ctx context.Context, traceId string) context.Context {
+	return context.WithValue(ctx, traceIDKey, traceId)
+}
 
-	id := ctx.Value("traceId")
+// TraceID gives trace ID stored in context, or empty string if there is none
+func TraceID(ctx context.Context) string {
+	if id, ok := ctx.Value(traceIDKey).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// NewTraceID generates random trace ID
+func NewTraceID() string {
+	return uuid.Must(uuid.NewRandom()).String()
+}
 
-	switch t := id.(type) {
+// WithLogger stores logger in context, logger is marked with trace ID of the request
+//
+// Trace ID is generated and stored in context if it does not have one yet
+func WithLogger(ctx context.Context, logger *logrus.Entry) context.Context {
 
-	case string:
-		traceId = t
-	case nil:
-		traceId = uuid.Must(uuid.NewRandom()).String()
-	default:
-		traceId = uuid.Must(uuid.NewRandom()).String()
+	traceId := TraceID(ctx)
+	if len(traceId) == 0 {
+		traceId = NewTraceID()
+		ctx = WithTraceID(ctx, traceId)
 	}
 
 	l := logger.WithFields(logrus.Fields{
-		"traceId": traceId,
+		FieldTraceID: traceId,
 	})
 
 	return context.WithValue(ctx, loggerKey, l)
 }
 
+// LoggerFromContext gives logger stored in context by WithLogger, if there is one
+func LoggerFromContext(ctx context.Context) (*logrus.Entry, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	l, ok := ctx.Value(loggerKey).(*logrus.Entry)
+	return l, ok && l != nil
+}
+
 // Logger From Context
+//
+// If context does not carry logger, default logger marked with trace ID of the context is given
 func LFC(ctx context.Context) *logrus.Entry {
 
-	l, ok := ctx.Value(loggerKey).(*logrus.Entry)
-
-	if !ok {
-		panic(fmt.Sprintf("Unable to get logger from context %+v", ctx))
+	if l, ok := LoggerFromContext(ctx); ok {
+		return l
 	}
 
+	l := DefaultLogger()
+	if ctx != nil {
+		if traceId := TraceID(ctx); len(traceId) > 0 {
+			l = l.WithField(FieldTraceID, traceId)
+		}
+	}
 	return l
 }
 
@@ -201,8 +265,8 @@ func JBase32ToStr(in string) (out string, err error) {
 	return string(bout[:]), err
 }
 
-func GetContext(traceId string) context.Context {
-	ctxuuid := uuid.Must(uuid.NewRandom()).String()
-	ctx := context.Background()
-	return context.WithValue(ctx, "traceId", ctxuuid)
+// GetContext creates context for operation that is not a part of gRPC request,
+// operation name prefixes generated trace ID
+func GetContext(operation string) context.Context {
+	return WithTraceID(context.Background(), operation+"-"+NewTraceID())
 }
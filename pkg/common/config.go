@@ -0,0 +1,251 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Default values of config properties that are not set in config file
+const (
+	DefaultLogLevel        = "Warning"
+	DefaultRestPort        = 82
+	DefaultRestProt        = "https"
+	DefaultRestTries       = 3
+	DefaultRestIdleTimeOut = "30s"
+	DefaultIqn             = "iqn.csi.2019-04"
+	DefaultISCSIPort       = 3260
+)
+
+// Environment variables that override config file properties,
+// they allow to keep credentials in separate Kubernetes secret
+const (
+	EnvPool          = "JDSS_POOL"
+	EnvEndpointAddrs = "JDSS_ENDPOINT_ADDRS" // comma separated
+	EnvEndpointUser  = "JDSS_ENDPOINT_USER"
+	EnvEndpointPass  = "JDSS_ENDPOINT_PASS"
+	EnvISCSIAddrs    = "JDSS_ISCSI_ADDRS" // comma separated
+)
+
+// maxIqnPrefixLen leaves space for volume name in 223 characters long iqn
+const maxIqnPrefixLen = 128
+
+var iqnRegexp = regexp.MustCompile(`^iqn\.[a-z0-9]([a-z0-9.:-]*[a-z0-9])?$`)
+
+var hostnameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// ConfigError lists all problems found in config
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+func (e *ConfigError) add(format string, a ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, a...))
+}
+
+// ParseConfig reads Config from YAML content of config file
+//
+// Unknown properties are rejected, environment overrides and defaults are applied
+// and resulting config is validated
+func ParseConfig(source []byte, c *JovianDSSCfg) error {
+	dec := yaml.NewDecoder(bytes.NewReader(source))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	c.applyEnv()
+	c.SetDefaults()
+	return c.Validate()
+}
+
+// applyEnv overrides config properties with values of JDSS_* environment variables
+func (c *JovianDSSCfg) applyEnv() {
+	if v, ok := os.LookupEnv(EnvPool); ok {
+		c.Pool = v
+	}
+	if v, ok := os.LookupEnv(EnvEndpointAddrs); ok {
+		c.RestEndpointCfg.Addrs = splitList(v)
+	}
+	if v, ok := os.LookupEnv(EnvEndpointUser); ok {
+		c.RestEndpointCfg.User = v
+	}
+	if v, ok := os.LookupEnv(EnvEndpointPass); ok {
+		c.RestEndpointCfg.Pass = v
+	}
+	if v, ok := os.LookupEnv(EnvISCSIAddrs); ok {
+		c.ISCSIEndpointCfg.Addrs = splitList(v)
+	}
+}
+
+func splitList(v string) (out []string) {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// SetDefaults fills properties that are not set with documented default values
+func (c *JovianDSSCfg) SetDefaults() {
+	if len(c.LLevel) == 0 {
+		c.LLevel = DefaultLogLevel
+	}
+	if len(c.LDest) == 0 {
+		c.LDest = c.LPath
+	}
+	if len(c.Pool) == 0 {
+		c.Pool = c.RestEndpointCfg.Pool
+	}
+
+	r := &c.RestEndpointCfg
+	if r.Port == 0 {
+		r.Port = DefaultRestPort
+	}
+	if len(r.Prot) == 0 {
+		r.Prot = DefaultRestProt
+	}
+	if r.Tries == 0 {
+		r.Tries = DefaultRestTries
+	}
+	if len(r.IdleTimeOut) == 0 {
+		r.IdleTimeOut = DefaultRestIdleTimeOut
+	}
+
+	i := &c.ISCSIEndpointCfg
+	if len(i.Iqn) == 0 {
+		i.Iqn = DefaultIqn
+	}
+	if i.Port == 0 {
+		i.Port = DefaultISCSIPort
+	}
+}
+
+// Validate checks that config is complete and its values are correct
+func (c *JovianDSSCfg) Validate() error {
+	var e ConfigError
+
+	if _, err := logrus.ParseLevel(c.LLevel); err != nil {
+		e.add("loglevel: %s", err)
+	}
+	if _, err := NewFormatter(c.LFormat); err != nil {
+		e.add("logformat: %s", err)
+	}
+	if len(c.LPath) > 0 && c.LPath != c.LDest {
+		e.add("logpath and logfile are set to different values")
+	}
+	if len(c.Pool) == 0 {
+		e.add("pool: is not set")
+	} else if strings.ContainsAny(c.Pool, "/@ ") {
+		e.add("pool: %q is not a valid pool name", c.Pool)
+	}
+
+	r := &c.RestEndpointCfg
+	validateAddrs(&e, "endpoint.addrs", r.Addrs)
+	validatePort(&e, "endpoint.port", r.Port)
+	if r.Prot != "http" && r.Prot != "https" {
+		e.add("endpoint.prot: %q, expected http or https", r.Prot)
+	}
+	// Credentials may be omitted if they are provided in CSI secrets
+	if (len(r.User) == 0) != (len(r.Pass) == 0) {
+		e.add("endpoint.user and endpoint.pass have to be set together")
+	}
+	if r.Tries < 1 {
+		e.add("endpoint.tries: %d, expected positive number", r.Tries)
+	}
+	validateDuration(&e, "endpoint.idletimeout", r.IdleTimeOut)
+	if (len(r.TLS.ClientCert) == 0) != (len(r.TLS.ClientKey) == 0) {
+		e.add("endpoint.tls: clientcert and clientkey have to be set together")
+	}
+
+	i := &c.ISCSIEndpointCfg
+	validateAddrs(&e, "iscsi.addrs", i.Addrs)
+	validatePort(&e, "iscsi.port", i.Port)
+	if len(i.Iqn) > maxIqnPrefixLen || !iqnRegexp.MatchString(i.Iqn) {
+		e.add("iscsi.iqn: %q is not a valid iqn prefix", i.Iqn)
+	}
+
+	if len(c.GCCfg.Interval) > 0 {
+		validateDuration(&e, "gc.interval", c.GCCfg.Interval)
+	}
+	if len(c.GCCfg.GracePeriod) > 0 {
+		validateDuration(&e, "gc.graceperiod", c.GCCfg.GracePeriod)
+	}
+
+	if len(e.Problems) > 0 {
+		return &e
+	}
+	return nil
+}
+
+// Deprecations lists deprecated properties that are set in config, they have to be reported to user
+func (c *JovianDSSCfg) Deprecations() (out []string) {
+	r := &c.RestEndpointCfg
+	if len(r.Name) > 0 {
+		out = append(out, "endpoint.name is deprecated and has no effect, remove it from config")
+	}
+	if len(r.Pool) > 0 {
+		if r.Pool == c.Pool {
+			out = append(out, "endpoint.pool is deprecated, set pool at top level of config instead")
+		} else {
+			out = append(out, fmt.Sprintf("endpoint.pool is deprecated, %q is ignored and pool %q is used", r.Pool, c.Pool))
+		}
+	}
+	return out
+}
+
+func validateAddrs(e *ConfigError, name string, addrs []string) {
+	if len(addrs) == 0 {
+		e.add("%s: no addresses provided", name)
+	}
+	for _, a := range addrs {
+		if net.ParseIP(a) == nil && !hostnameRegexp.MatchString(a) {
+			e.add("%s: %q is neither IP address nor host name", name, a)
+		}
+	}
+}
+
+func validatePort(e *ConfigError, name string, port int) {
+	if port < 1 || port > 65535 {
+		e.add("%s: %d is out of range 1-65535", name, port)
+	}
+}
+
+func validateDuration(e *ConfigError, name string, d string) {
+	if v, err := time.ParseDuration(d); err != nil {
+		e.add("%s: %s", name, err)
+	} else if v <= 0 {
+		e.add("%s: %s, expected positive duration", name, d)
+	}
+}
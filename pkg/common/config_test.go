@@ -0,0 +1,74 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package common
+
+import (
+	"testing"
+)
+
+// testConfig gives config with given top level and endpoint properties
+func testConfig(top string, endpoint string) []byte {
+	return []byte(top + `
+endpoint:
+  addrs:
+    - 192.168.0.100
+  user: admin
+  pass: admin
+` + endpoint + `
+iscsi:
+  addrs:
+    - 192.168.0.100
+`)
+}
+
+func TestParseConfigAcceptsLegacyEndpointProperties(t *testing.T) {
+	cases := []struct {
+		name         string
+		top          string
+		endpoint     string
+		pool         string
+		deprecations int
+	}{
+		{"current", "pool: Pool-0", "", "Pool-0", 0},
+		{"legacy pool", "", "  pool: Pool-0", "Pool-0", 1},
+		{"legacy name and pool", "", "  name: MainStorage\n  pool: Pool-0", "Pool-0", 2},
+		{"both pools", "pool: Pool-1", "  pool: Pool-0", "Pool-1", 1},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var cfg JovianDSSCfg
+			if err := ParseConfig(testConfig(c.top, c.endpoint), &cfg); err != nil {
+				t.Fatalf("config is rejected: %s", err)
+			}
+			if cfg.Pool != c.pool {
+				t.Errorf("got pool %q, expected %q", cfg.Pool, c.pool)
+			}
+			if d := cfg.Deprecations(); len(d) != c.deprecations {
+				t.Errorf("got deprecations %q, expected %d of them", d, c.deprecations)
+			}
+		})
+	}
+}
+
+func TestParseConfigRejectsUnknownProperties(t *testing.T) {
+	var cfg JovianDSSCfg
+	if err := ParseConfig(testConfig("pool: Pool-0", "  unknown: value"), &cfg); err == nil {
+		t.Errorf("config with unknown property is accepted")
+	}
+}
@@ -0,0 +1,43 @@
+package common
+
+import (
+	"sync"
+)
+
+// KeyLock keeps track of resources that are being operated on, resources are identified by keys
+type KeyLock struct {
+	mu   sync.Mutex
+	held map[string]struct{}
+}
+
+// NewKeyLock creates KeyLock with no keys taken
+func NewKeyLock() *KeyLock {
+	return &KeyLock{held: make(map[string]struct{})}
+}
+
+// TryLock takes all given keys at once, it does not wait and fails if any of keys is already taken,
+// in that case none of keys is taken
+func (kl *KeyLock) TryLock(keys ...string) bool {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	for _, k := range keys {
+		if _, taken := kl.held[k]; taken {
+			return false
+		}
+	}
+	for _, k := range keys {
+		kl.held[k] = struct{}{}
+	}
+	return true
+}
+
+// Unlock releases given keys
+func (kl *KeyLock) Unlock(keys ...string) {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+
+	for _, k := range keys {
+		delete(kl.held, k)
+	}
+}
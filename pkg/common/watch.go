@@ -0,0 +1,77 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WatchFile calls onChange with new content of file at path every time it changes,
+// file is checked every interval until ctx is done
+//
+// Content is compared rather than modification time, since Kubernetes updates
+// projected volumes by swapping symlinks. File that can not be read is reported and skipped,
+// panic in onChange is logged and watching continues
+func WatchFile(ctx context.Context, path string, interval time.Duration, l *logrus.Entry, onChange func(content []byte)) {
+	l = l.WithFields(logrus.Fields{
+		"func": "WatchFile",
+		"path": path,
+	})
+
+	var last []byte
+	if content, err := os.ReadFile(path); err == nil {
+		sum := sha256.Sum256(content)
+		last = sum[:]
+	} else {
+		l.Warnf("Unable to read file: %s", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			l.Warnf("Unable to read file: %s", err)
+			continue
+		}
+		sum := sha256.Sum256(content)
+		if bytes.Equal(sum[:], last) {
+			continue
+		}
+		last = sum[:]
+
+		l.Info("File changed")
+		func() {
+			defer RecoverPanic(l, "file watcher")
+			onChange(content)
+		}()
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"os"
 
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -89,22 +90,29 @@ var supportedVolumeCapabilities = []csi.VolumeCapability_AccessMode_Mode{
 
 // ControllerPlugin provides CSI controller plugin interface
 type ControllerPlugin struct {
-	l                *log.Logger
-	le               *log.Entry
-	cfg              *ControllerCfg
-	iqnPrefix        string
-	snapReg          string
-	volumesAccess    sync.Mutex
-	volumesInProcess map[string]bool
+	l         *log.Logger
+	le        *log.Entry
+	cfg       *ControllerCfg
+	iqnPrefix string
+	snapReg   string
+	locks     *jcom.KeyLock
 
 	pool             string
 	d                *jdrvr.CSIDriver
-	re               jrest.RestEndpoint
+	gc               *jdrvr.GarbageCollector
+	naming           *jdrvr.VolumeNaming
+	re               jrest.StorageInterface
+	cfgMu            sync.RWMutex // guards properties below that are replaced on Reload
 	iscsiEndpointCfg jcom.ISCSIEndpointCfg
+	restCfg          jcom.RestEndpointCfg
+	defaultCreds     bool // config file provides REST credentials
+
+	// drivers connected with credentials from CSI secrets, by secretKey
+	secretsMu     sync.Mutex
+	secretDrivers *driverCache
 	// TODO: add iscsi endpoint
 	//iscsiEndpoint    []*rest.StorageInterface
 	capabilities []*csi.ControllerServiceCapability
-	vCap         []*csi.VolumeCapability
 }
 
 type origin struct {
@@ -138,62 +146,119 @@ func parseOrigin(or string) (*origin, error) {
 func SetupControllerPlugin(cp *ControllerPlugin, cfg *jcom.JovianDSSCfg) (err error) {
 	// var vol csi_rest.Volume = csi_rest.Volume{Name: "test-1", Size: "1G"}
 	var e error
-	if cp.l, e = jcom.GetLogger(cfg.LLevel, cfg.LDest); e != nil {
+	if cp.l, e = jcom.GetLogger(cfg.LLevel, cfg.LFormat, cfg.LDest); e != nil {
 		fmt.Fprintln(os.Stderr, "Unable to init loging because:", e)
 		os.Exit(1)
 	}
-	cp.le = cp.l.WithFields(log.Fields{"section": "controller", "traceId": "setup"})
+	cp.le = cp.l.WithFields(log.Fields{"section": "controller", jcom.FieldTraceID: "setup", jcom.FieldPool: cfg.Pool})
 
-	if cp.d, err = jdrvr.NewJovianDSSCSIDriver(&cfg.RestEndpointCfg, cp.le); err != nil {
+	var re jrest.RestEndpoint
+	if err = jrest.SetupEndpoint(&re, &cfg.RestEndpointCfg, cp.le); err != nil {
 		return err
 	}
+	cp.re = &re
 
-	jrest.SetupEndpoint(&cp.re, &cfg.RestEndpointCfg, cp.le)
+	if cp.d, err = jdrvr.NewJovianDSSCSIDriver(cp.re, cp.le); err != nil {
+		return err
+	}
 
 	if len(cfg.ISCSIEndpointCfg.Iqn) == 0 {
-		cfg.ISCSIEndpointCfg.Iqn = "iqn.csi.2019-04"
+		cfg.ISCSIEndpointCfg.Iqn = jcom.DefaultIqn
 	}
 	cp.iqnPrefix = cfg.ISCSIEndpointCfg.Iqn
 	cp.iscsiEndpointCfg = cfg.ISCSIEndpointCfg
+	cp.restCfg = cfg.RestEndpointCfg
+	cp.defaultCreds = len(cfg.RestEndpointCfg.User) > 0
+	cp.secretDrivers = newDriverCache(maxSecretDrivers)
 	//cp.le.Debugf("Iscsi config %+v", cfg.ISCSIEndpointCfg)
 	cp.pool = cfg.Pool
-	// cp.volumesInProcess = make(map[string]bool)
+	cp.locks = jcom.NewKeyLock()
+
+	if cp.naming, err = jdrvr.NewVolumeNaming(&cfg.NamingCfg); err != nil {
+		return err
+	}
+
+	if cfg.GCCfg.Enabled && !cp.defaultCreds {
+		cp.le.Warn("Garbage collector is disabled, it requires REST credentials in config file")
+	} else if cfg.GCCfg.Enabled {
+		if cp.gc, err = jdrvr.NewGarbageCollector(cp.d, cp.pool, cp.iqnPrefix, cp.naming, &cfg.GCCfg, cp.le); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
-func (cp *ControllerPlugin) lockVolume(vID string) error {
-	var err error
-	err = nil
-	msg := fmt.Sprintf("Volume %s is busy", vID)
-	errFail := status.Error(codes.Aborted, msg)
+// StartGC runs garbage collector in background if it is enabled in config
+func (cp *ControllerPlugin) StartGC(ctx context.Context) {
+	if cp.gc == nil {
+		cp.le.Debug("Garbage collector is disabled")
+		return
+	}
+	go cp.gc.Run(ctx)
+}
 
-	cp.volumesAccess.Lock()
-	if cp.volumesInProcess[vID] == false {
-		cp.volumesInProcess[vID] = true
-	} else {
-		err = errFail
+func volumeLockKey(vID string) string {
+	return "volume/" + vID
+}
+
+func snapshotLockKey(sID string) string {
+	return "snapshot/" + sID
+}
+
+// lockVolume marks volume as being operated on, it fails with ABORTED if other operation on volume is in progress
+func (cp *ControllerPlugin) lockVolume(vID string) error {
+	if !cp.locks.TryLock(volumeLockKey(vID)) {
+		return status.Errorf(codes.Aborted, "Operation on volume %s is already in progress", vID)
 	}
-	cp.volumesAccess.Unlock()
+	return nil
+}
 
-	return err
+func (cp *ControllerPlugin) unlockVolume(vID string) {
+	cp.locks.Unlock(volumeLockKey(vID))
 }
 
-func (cp *ControllerPlugin) unlockVolume(vID string) error {
-	var err error
-	err = nil
-	msg := fmt.Sprintf("Volume %s is not locked", vID)
-	errFail := status.Error(codes.FailedPrecondition, msg)
+// lockResources marks all resources operation touches as being operated on,
+// it fails with ABORTED if other operation on any of them is in progress
+//
+// Keys are sorted, so resources are always taken in the same order
+// and all of them are taken at once or none of them is taken
+func (cp *ControllerPlugin) lockResources(keys ...string) error {
+	sort.Strings(keys)
+	if !cp.locks.TryLock(keys...) {
+		return status.Errorf(codes.Aborted, "Operation on %s is already in progress", strings.Join(keys, ", "))
+	}
+	return nil
+}
 
-	cp.volumesAccess.Lock()
-	if cp.volumesInProcess[vID] == true {
-		delete(cp.volumesInProcess, vID)
-	} else {
-		err = errFail
+func (cp *ControllerPlugin) unlockResources(keys ...string) {
+	cp.locks.Unlock(keys...)
+}
+
+// volumeFromID parses volume ID given in request,
+// volume with ID of wrong format can not exist, so it is reported as NOT_FOUND
+func volumeFromID(vID string) (*jdrvr.VolumeDesc, error) {
+	if len(vID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+	vd, err := jdrvr.NewVolumeDescFromCSIID(vID)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "Volume %s does not exist: %s", vID, status.Convert(err).Message())
 	}
-	cp.volumesAccess.Unlock()
+	return vd, nil
+}
 
-	return err
+// snapshotFromID parses snapshot ID given in request,
+// snapshot with ID of wrong format can not exist, so it is reported as NOT_FOUND
+func snapshotFromID(sID string) (*jdrvr.SnapshotDesc, error) {
+	if len(sID) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot ID missing in request")
+	}
+	sd, err := jdrvr.NewSnapshotDescFromCSIID(sID)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "Snapshot %s does not exist: %s", sID, status.Convert(err).Message())
+	}
+	return sd, nil
 }
 
 func (cp *ControllerPlugin) getStandardID(name string) string {
@@ -242,12 +307,11 @@ func (cp *ControllerPlugin) getRandomPassword(l int) (s string) {
 
 func (cp *ControllerPlugin) getVolume(ctx context.Context, vID string) (*jrest.ResourceVolume, error) {
 	// return nil, nil
-	l := cp.l.WithField("traceId", ctx.Value("traceId"))
+	l := cp.l.WithField(jcom.FieldTraceID, jcom.TraceID(ctx))
 	//Value("traceId").(string))
 
 	l.Debugf("context %+v", ctx)
 	l.Debugf("Get volume with id: %s", vID)
-	var err error
 
 	//////////////////////////////////////////////////////////////////////////////
 	/// Checks
@@ -264,25 +328,13 @@ func (cp *ControllerPlugin) getVolume(ctx context.Context, vID string) (*jrest.R
 
 	l.Debugf("%+v\n", v)
 	l.Debugf("%+v\n", rErr)
-	l.Debugf("%+v\n", rErr.GetCode())
 	if rErr != nil {
-		switch rErr.GetCode() {
-		case jrest.RestErrorRequestMalfunction:
-			// TODO: correctly process error messages
-			err = status.Error(codes.NotFound, rErr.Error())
-		case jrest.RestErrorRPM:
-			err = status.Error(codes.Internal, rErr.Error())
-		case jrest.RestErrorResourceDNE:
-			err = status.Error(codes.NotFound, rErr.Error())
-		default:
-			err = status.Error(codes.Internal, rErr.Error())
-		}
-		return nil, err
+		return nil, restStatus(rErr, fmt.Sprintf("Unable to get volume %s", vID))
 	}
 	return v, nil
 }
 
-func (cp *ControllerPlugin) createNewVolume(ctx context.Context, nvd *jdrvr.VolumeDesc, capr *csi.CapacityRange, vSource *csi.VolumeContentSource) (volumeSize int64, csierr error) {
+func (cp *ControllerPlugin) createNewVolume(ctx context.Context, nvd *jdrvr.VolumeDesc, capr *csi.CapacityRange, vSource *csi.VolumeContentSource, md jdrvr.Metadata) (volumeSize int64, csierr error) {
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(log.Fields{
@@ -296,25 +348,23 @@ func (cp *ControllerPlugin) createNewVolume(ctx context.Context, nvd *jdrvr.Volu
 		if srcSnapshot := vSource.GetSnapshot(); srcSnapshot != nil {
 			// Snapshot
 			sourceSnapshotID := srcSnapshot.GetSnapshotId()
-			sd, err := jdrvr.NewSnapshotDescFromCSIID(sourceSnapshotID)
-			if err == nil {
-				l.Debugf("Creating volume %s from snapshot %s", nvd.Name(), sd.Name())
-				err = cp.d.CreateVolumeFromSnapshot(ctx, cp.pool, sd, nvd)
-			} else {
-				return 0, status.Error(codes.InvalidArgument, fmt.Sprintf("Unable to identify snapshot source %s", sourceSnapshotID))
+			sd, csierr := snapshotFromID(sourceSnapshotID)
+			if csierr != nil {
+				return 0, csierr
 			}
+			l.Debugf("Creating volume %s from snapshot %s", nvd.Name(), sd.Name())
+			err = cp.drv(ctx).CreateVolumeFromSnapshot(ctx, cp.pool, sd, nvd, md)
 
 		} else if srcVolume := vSource.GetVolume(); srcVolume != nil {
 			// Volume
 			sourceVolumeID := srcVolume.GetVolumeId()
 			// Check if volume exists
-			vd, csierr := jdrvr.NewVolumeDescFromVDS(sourceVolumeID)
-			if csierr == nil {
-				l.Debugf("Creating volume %s from volume %s", nvd.Name(), vd.Name())
-				err = cp.d.CreateVolumeFromVolume(ctx, cp.pool, vd, nvd)
-			} else {
-				return 0, status.Error(codes.InvalidArgument, fmt.Sprintf("Unable to identify volume source %s", sourceVolumeID))
+			vd, csierr := volumeFromID(sourceVolumeID)
+			if csierr != nil {
+				return 0, csierr
 			}
+			l.Debugf("Creating volume %s from volume %s", nvd.Name(), vd.Name())
+			err = cp.drv(ctx).CreateVolumeFromVolume(ctx, cp.pool, vd, nvd, md)
 
 		} else {
 			return 0, status.Errorf(codes.Unimplemented, "Unable to create volume from other sources")
@@ -322,7 +372,8 @@ func (cp *ControllerPlugin) createNewVolume(ctx context.Context, nvd *jdrvr.Volu
 	} else {
 		l.Debugf("required bytes %d, limit bytes %d", capr.GetRequiredBytes(), capr.GetLimitBytes())
 
-		if capr.GetLimitBytes() == capr.GetRequiredBytes() {
+		// Capacity range is optional, smallest volume is created without it
+		if capr.GetLimitBytes() > 0 && capr.GetLimitBytes() == capr.GetRequiredBytes() {
 			volumeSize = capr.GetLimitBytes()
 		} else if capr.GetRequiredBytes() < minSupportedVolumeSize {
 			volumeSize = minSupportedVolumeSize
@@ -330,27 +381,19 @@ func (cp *ControllerPlugin) createNewVolume(ctx context.Context, nvd *jdrvr.Volu
 			volumeSize = capr.GetRequiredBytes()
 		}
 
-		err = cp.d.CreateVolume(ctx, cp.pool, nvd, volumeSize)
+		err = cp.drv(ctx).CreateVolume(ctx, cp.pool, nvd, volumeSize, md)
 	}
 
 	switch jrest.ErrCode(err) {
-	case jrest.RestErrorResourceBusy:
-		return 0, status.Error(codes.FailedPrecondition, err.Error())
-	case jrest.RestErrorResourceDNE:
-		return 0, status.Error(codes.NotFound, err.Error())
-	case jrest.RestErrorResourceExists:
-		l.Warn("Specified volume already exists.")
-		return 0, status.Errorf(codes.AlreadyExists, err.Error())
-	case jrest.RestErrorOutOfSpace:
-		emsg := fmt.Sprintf("Unable to create volume %s, storage out of space", nvd.Name())
-		l.Warn(emsg)
-		return 0, status.Errorf(codes.ResourceExhausted, emsg)
 	case jrest.RestErrorOk:
 		l.Debugf("Volume %s created", nvd.Name())
 		return volumeSize, nil
-	default:
-		return 0, status.Errorf(codes.Internal, err.Error())
+	case jrest.RestErrorResourceExists:
+		l.Warn("Specified volume already exists.")
+	case jrest.RestErrorOutOfSpace:
+		l.Warnf("Unable to create volume %s, storage out of space", nvd.Name())
 	}
+	return 0, restStatus(err, fmt.Sprintf("Unable to create volume %s", nvd.Name()), volumeResource(nvd))
 }
 
 // VolumeComply checks if volume with specified properties exists
@@ -358,7 +401,7 @@ func (cp *ControllerPlugin) createNewVolume(ctx context.Context, nvd *jdrvr.Volu
 // if volume with same name exists yet does not fall into requirments it fails with ALLREADY_EXISTS
 // if volume does not exists it fails with NOT_FOUND
 // if volume do exists and fit requirmnets it will return csi volume struct and nil as error
-func (cp *ControllerPlugin) VolumeComply(ctx context.Context, vd *jdrvr.VolumeDesc, caprage *csi.CapacityRange, source *csi.VolumeContentSource) (*int64, error) {
+func (cp *ControllerPlugin) VolumeComply(ctx context.Context, vd *jdrvr.VolumeDesc, md jdrvr.Metadata, caprage *csi.CapacityRange, source *csi.VolumeContentSource) (*int64, error) {
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(log.Fields{
@@ -368,12 +411,15 @@ func (cp *ControllerPlugin) VolumeComply(ctx context.Context, vd *jdrvr.VolumeDe
 
 	l.Debugf("Checking if volume %s exists and comply with requirments %+v %+v", vd.Name(), caprage, source)
 
-	vdata, jerr := cp.d.GetVolume(ctx, cp.pool, vd)
+	vdata, jerr := cp.drv(ctx).GetVolume(ctx, cp.pool, vd)
 
 	if jerr != nil {
-		if jerr.GetCode() == jrest.RestErrorResourceDNE {
-			return nil, status.Errorf(codes.NotFound, jerr.Error())
-		}
+		return nil, restStatus(jerr, fmt.Sprintf("Unable to get volume %s", vd.Name()), volumeResource(vd))
+	}
+
+	// Naming template might give same volume name for different CSI names
+	if name := jdrvr.NewMetadataFromUserProperties(vdata.UserProperties).Name(); len(name) > 0 && name != md.Name() {
+		return nil, status.Errorf(codes.AlreadyExists, fmt.Sprintf("Volume %s exists, but it was created for %s", vd.Name(), name))
 	}
 
 	s := vdata.GetSize()
@@ -402,7 +448,7 @@ func (cp *ControllerPlugin) VolumeComply(ctx context.Context, vd *jdrvr.VolumeDe
 
 		if sv := source.GetSnapshot(); sv != nil {
 
-			if vol, err := jdrvr.NewVolumeDescFromVDS(vdata.OriginVolume()); err != nil {
+			if vol, err := jdrvr.NewVolumeDescFromPath(vdata.OriginVolume()); err != nil {
 				return nil, status.Errorf(codes.AlreadyExists, fmt.Sprintf("Volume %s exists, but driver is not able to identify correctly its origin %s", vd.Name(), vdata.OriginVolume()))
 			} else {
 				if snap, err := jdrvr.NewSnapshotDescFromSDS(vol, vdata.OriginSnapshot()); err != nil {
@@ -425,11 +471,15 @@ func (cp *ControllerPlugin) VolumeComply(ctx context.Context, vd *jdrvr.VolumeDe
 func (cp *ControllerPlugin) CreateVolume(ctx context.Context, req *csi.CreateVolumeRequest) (*csi.CreateVolumeResponse, error) {
 
 	l := cp.l.WithFields(log.Fields{
-		"request": "CreateVolume",
-		"func":    "CreateVolume",
-		"section": "controller",
+		jcom.FieldRPC: "CreateVolume",
+		"func":        "CreateVolume",
+		"section":     "controller",
 	})
 	ctx = jcom.WithLogger(ctx, l)
+	ctx, sErr := cp.withSecrets(ctx, req.GetSecrets())
+	if sErr != nil {
+		return nil, sErr
+	}
 
 	l.Debugf("Receiver create volume request with context %+v", ctx)
 	var err error
@@ -447,11 +497,38 @@ func (cp *ControllerPlugin) CreateVolume(ctx context.Context, req *csi.CreateVol
 		l.Warnf("Unable to create volume req: %v", req)
 		return nil, err
 	}
-	// vName := req.GetName()
+	if len(req.GetName()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Name missing in request")
+	}
+
+	md := cp.naming.Metadata(req.GetName(), req.GetParameters())
+
 	var nvid *jdrvr.VolumeDesc
-	if nvid, err = jdrvr.NewVolumeDescFromName(req.GetName()); err != nil {
+	if nvid, err = jdrvr.NewVolumeDescFromName(cp.naming.VolumeName(md)); err != nil {
+		return nil, err
+	}
+	if err = nvid.SetParent(cp.naming.VolumeParent(md)); err != nil {
+		return nil, err
+	}
+
+	// Source is locked as well, so it is not deleted while volume is created from it.
+	// Keys are made of parsed IDs, the same way other operations make them,
+	// source with ID of wrong format does not exist and is reported later
+	keys := []string{volumeLockKey(nvid.CSIID())}
+	if sv := req.GetVolumeContentSource().GetVolume(); sv != nil {
+		if svd, err := jdrvr.NewVolumeDescFromCSIID(sv.GetVolumeId()); err == nil {
+			keys = append(keys, volumeLockKey(svd.CSIID()))
+		}
+	}
+	if ss := req.GetVolumeContentSource().GetSnapshot(); ss != nil {
+		if ssd, err := jdrvr.NewSnapshotDescFromCSIID(ss.GetSnapshotId()); err == nil {
+			keys = append(keys, volumeLockKey(ssd.GetVD().CSIID()), snapshotLockKey(ssd.CSIID()))
+		}
+	}
+	if err = cp.lockResources(keys...); err != nil {
 		return nil, err
 	}
+	defer cp.unlockResources(keys...)
 
 	// TODO: process volume capabilities
 	caps := req.GetVolumeCapabilities()
@@ -471,25 +548,25 @@ func (cp *ControllerPlugin) CreateVolume(ctx context.Context, req *csi.CreateVol
 	l.Debugf("Create volume capability check done")
 
 	// Check if volume exists and comply with requirments
-	vsize, err := cp.VolumeComply(ctx, nvid, req.GetCapacityRange(), req.GetVolumeContentSource())
+	vsize, err := cp.VolumeComply(ctx, nvid, md, req.GetCapacityRange(), req.GetVolumeContentSource())
 	switch status.Code(err) {
 	case codes.AlreadyExists:
 		return nil, err
 	case codes.OK:
 		l.Debugf("Volume %s already exist and comply with requirmnets", nvid.Name())
-		out.Volume.VolumeId = nvid.VDS()
+		out.Volume.VolumeId = nvid.CSIID()
 		out.Volume.CapacityBytes = *vsize
 		return &out, nil
 	case codes.NotFound:
 		l.Debugf("Volume %s do not exists, creating", nvid.Name())
 	default:
-		return nil, status.Error(codes.Unknown, fmt.Sprintf("Unable to identify if volume exists or not: %s", err.Error()))
+		return nil, err
 	}
 
-	if vSize, err := cp.createNewVolume(ctx, nvid, req.GetCapacityRange(), req.GetVolumeContentSource()); err != nil {
+	if vSize, err := cp.createNewVolume(ctx, nvid, req.GetCapacityRange(), req.GetVolumeContentSource(), md); err != nil {
 		return nil, err
 	} else {
-		out.Volume.VolumeId = nvid.VDS()
+		out.Volume.VolumeId = nvid.CSIID()
 		out.Volume.CapacityBytes = vSize
 	}
 
@@ -500,11 +577,16 @@ func (cp *ControllerPlugin) CreateVolume(ctx context.Context, req *csi.CreateVol
 func (cp *ControllerPlugin) DeleteVolume(ctx context.Context, req *csi.DeleteVolumeRequest) (*csi.DeleteVolumeResponse, error) {
 
 	l := cp.l.WithFields(log.Fields{
-		"request": "DeleteVolume",
-		"func":    "DeleteVolume",
-		"section": "controller",
+		jcom.FieldRPC:      "DeleteVolume",
+		jcom.FieldVolumeID: req.GetVolumeId(),
+		"func":             "DeleteVolume",
+		"section":          "controller",
 	})
 	ctx = jcom.WithLogger(ctx, l)
+	ctx, sErr := cp.withSecrets(ctx, req.GetSecrets())
+	if sErr != nil {
+		return nil, sErr
+	}
 
 	// Check arguments
 	if len(req.GetVolumeId()) == 0 {
@@ -516,26 +598,31 @@ func (cp *ControllerPlugin) DeleteVolume(ctx context.Context, req *csi.DeleteVol
 		return nil, err
 	}
 
-	if vd, rerr := jdrvr.NewVolumeDescFromVDS(req.VolumeId); rerr == nil {
+	if vd, rerr := jdrvr.NewVolumeDescFromCSIID(req.VolumeId); rerr == nil {
+
+		if err := cp.lockVolume(vd.CSIID()); err != nil {
+			return nil, err
+		}
+		defer cp.unlockVolume(vd.CSIID())
 
 		l.Debugf("Deleting volume %s", vd.Name())
 
 		// Try to delete without recursiuon
-		if err := cp.d.DeleteVolume(ctx, cp.pool, vd); err == nil {
+		if err := cp.drv(ctx).DeleteVolume(ctx, cp.pool, vd); err == nil {
 			return &csi.DeleteVolumeResponse{}, nil
 		} else {
 			switch err.GetCode() {
-			case jrest.RestErrorResourceBusy:
-				return nil, status.Error(codes.FailedPrecondition, err.Error())
-			case jrest.RestErrorResourceDNE:
+			case jrest.RestErrorResourceDNE, jrest.RestErrorResourceDNEVolume:
 				l.Warnf("Volume %s was deleted before", vd)
 				return &csi.DeleteVolumeResponse{}, nil
 			default:
-				return nil, status.Errorf(codes.Internal, err.Error())
+				return nil, restStatus(err, fmt.Sprintf("Unable to delete volume %s", vd.Name()), volumeResource(vd))
 			}
 		}
 	} else {
-		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume id %s has wrong name format", req.VolumeId))
+		// Volume with id of wrong format can not exist
+		l.Warnf("Volume id %s has wrong name format, there is nothing to delete", req.VolumeId)
+		return &csi.DeleteVolumeResponse{}, nil
 	}
 }
 
@@ -547,11 +634,15 @@ func (cp *ControllerPlugin) ListVolumes(ctx context.Context, req *csi.ListVolume
 	var resp csi.ListVolumesResponse
 
 	l := cp.l.WithFields(log.Fields{
-		"request": "ListVolumes",
-		"func":    "ListVolumes",
-		"section": "controller",
+		jcom.FieldRPC: "ListVolumes",
+		"func":        "ListVolumes",
+		"section":     "controller",
 	})
 	ctx = jcom.WithLogger(ctx, l)
+	ctx, sErr := cp.withConfigCreds(ctx)
+	if sErr != nil {
+		return nil, sErr
+	}
 
 	l.Debugf("Request: %+v", req)
 
@@ -567,15 +658,15 @@ func (cp *ControllerPlugin) ListVolumes(ctx context.Context, req *csi.ListVolume
 		return nil, status.Errorf(codes.Internal, "Number of Entries must not be negative.")
 	}
 
-	if volList, ts, rErr := cp.d.ListAllVolumes(ctx, cp.pool, int(maxEnt), *token); rErr != nil {
+	if volList, ts, rErr := cp.drv(ctx).ListAllVolumes(ctx, cp.pool, int(maxEnt), *token); rErr != nil {
 		l.Debugf("Unable to comlete listing %s", rErr.Error())
-		return nil, status.Errorf(codes.Internal, "Unable to complete listing request: %s", rErr.Error())
+		return nil, restStatus(rErr, "Unable to complete listing request")
 	} else {
 		if ts != nil {
 			resp.NextToken = ts.Token()
 		}
 
-		if err := completeListResponseFromVolume(ctx, &resp, volList); err != nil {
+		if err := completeListResponseFromVolume(ctx, &resp, volList, cp.naming); err != nil {
 			return nil, err
 		} else {
 			return &resp, nil
@@ -588,11 +679,16 @@ func (cp *ControllerPlugin) ListVolumes(ctx context.Context, req *csi.ListVolume
 func (cp *ControllerPlugin) CreateSnapshot(ctx context.Context, req *csi.CreateSnapshotRequest) (*csi.CreateSnapshotResponse, error) {
 
 	l := cp.l.WithFields(log.Fields{
-		"request": "CreateSnapshot",
-		"func":    "CreateSnapshot",
+		jcom.FieldRPC:      "CreateSnapshot",
+		jcom.FieldVolumeID: req.GetSourceVolumeId(),
+		"func":             "CreateSnapshot",
 	})
 
 	ctx = jcom.WithLogger(ctx, l)
+	ctx, sErr := cp.withSecrets(ctx, req.GetSecrets())
+	if sErr != nil {
+		return nil, sErr
+	}
 
 	l.Debugf("request: %+v", *req)
 	var err error
@@ -613,39 +709,45 @@ func (cp *ControllerPlugin) CreateSnapshot(ctx context.Context, req *csi.CreateS
 		return nil, err
 	}
 
-	sd := jdrvr.NewSnapshotDescFromName(vd, req.GetName())
+	sd, err := jdrvr.NewSnapshotDescFromName(vd, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	// Source volume is locked, so it is not deleted while snapshot is taken
+	keys := []string{volumeLockKey(vd.CSIID()), snapshotLockKey(sd.CSIID())}
+	if err = cp.lockResources(keys...); err != nil {
+		return nil, err
+	}
+	defer cp.unlockResources(keys...)
 
-	rErr := cp.d.CreateSnapshot(ctx, cp.pool, vd, sd)
+	// Storage scopes snapshot name to its volume, while CSI requires it to be unique
+	if ovd, rErr := cp.snapshotSource(ctx, sd); rErr != nil {
+		return nil, restStatus(rErr, fmt.Sprintf("Unable to check if snapshot %s already exists", sd.Name()))
+	} else if ovd != nil && ovd.CSIID() != vd.CSIID() {
+		return nil, status.Errorf(codes.AlreadyExists, "Snapshot %s already exists for volume %s", req.GetName(), ovd.CSIID())
+	}
+
+	md := cp.naming.Metadata(req.GetName(), req.GetParameters())
+	rErr := cp.drv(ctx).CreateSnapshot(ctx, cp.pool, vd, sd, md)
 
 	switch jrest.ErrCode(rErr) {
-	case jrest.RestErrorResourceBusy:
-		return nil, status.Error(codes.Aborted, err.Error())
-	case jrest.RestErrorResourceDNE:
-		return nil, status.Error(codes.FailedPrecondition, err.Error())
 	case jrest.RestErrorResourceExists:
 		l.Warn("Specified snapshot already exists.")
-	case jrest.RestErrorOutOfSpace:
-		emsg := fmt.Sprintf("Unable to create snapshot %s for volume %s, storage out of space", sd.Name(), vd.Name())
-		l.Warn(emsg)
-		return nil, status.Errorf(codes.ResourceExhausted, emsg)
 	case jrest.RestErrorOk:
 		l.Debugf("Snapshot %s was created", sd.Name())
 	default:
-		return nil, status.Errorf(codes.Internal, err.Error())
+		if jrest.ErrCode(rErr) == jrest.RestErrorOutOfSpace {
+			l.Warnf("Unable to create snapshot %s for volume %s, storage out of space", sd.Name(), vd.Name())
+		}
+		return nil, restStatus(rErr, fmt.Sprintf("Unable to create snapshot %s", sd.Name()), snapshotResource(sd), volumeResource(vd))
 	}
 
-	snap, rErr := cp.d.GetSnapshot(ctx, cp.pool, vd, sd)
-
-	switch jrest.ErrCode(rErr) {
-	case jrest.RestErrorResourceBusy:
-		return nil, status.Error(codes.Aborted, err.Error())
-	case jrest.RestErrorResourceDNE:
-		return nil, status.Error(codes.FailedPrecondition, err.Error())
-	case jrest.RestErrorOk:
-		l.Debugf("Got snapshot %s info %+v", sd.Name(), *snap)
-	default:
-		return nil, status.Errorf(codes.Internal, err.Error())
+	snap, rErr := cp.drv(ctx).GetSnapshot(ctx, cp.pool, vd, sd)
+	if rErr != nil {
+		return nil, restStatus(rErr, fmt.Sprintf("Unable to get snapshot %s", sd.Name()), snapshotResource(sd))
 	}
+	l.Debugf("Got snapshot %s info %+v", sd.Name(), *snap)
 	creationTime := &timestamppb.Timestamp{
 		Seconds: snap.Creation.Unix(),
 	}
@@ -662,15 +764,43 @@ func (cp *ControllerPlugin) CreateSnapshot(ctx context.Context, req *csi.CreateS
 	return &rsp, nil
 }
 
+// snapshotSource gives volume that snapshot with the same name was made from,
+// nil if cluster has no such snapshot
+func (cp *ControllerPlugin) snapshotSource(ctx context.Context, sd *jdrvr.SnapshotDesc) (*jdrvr.VolumeDesc, jrest.RestError) {
+
+	snaps, _, rErr := cp.drv(ctx).ListAllSnapshots(ctx, cp.pool, 0, jdrvr.NewCSIListingToken())
+	if rErr != nil {
+		return nil, rErr
+	}
+
+	for _, s := range snaps {
+		if s.Name != sd.SDS() {
+			continue
+		}
+		vd, err := jdrvr.NewVolumeDescFromPath(s.Volume)
+		if err != nil {
+			continue
+		}
+		if cp.naming.Owns(vd.Name(), s.Properties.UserProperties) {
+			return vd, nil
+		}
+	}
+	return nil, nil
+}
+
 // DeleteSnapshot deletes snapshot
 func (cp *ControllerPlugin) DeleteSnapshot(ctx context.Context, req *csi.DeleteSnapshotRequest) (*csi.DeleteSnapshotResponse, error) {
 
 	l := cp.l.WithFields(log.Fields{
-		"request": "DeleteSnapshot",
-		"func":    "DeleteSnapshot",
+		jcom.FieldRPC: "DeleteSnapshot",
+		"func":        "DeleteSnapshot",
 	})
 
 	ctx = jcom.WithLogger(ctx, l)
+	ctx, sErr := cp.withSecrets(ctx, req.GetSecrets())
+	if sErr != nil {
+		return nil, sErr
+	}
 
 	l.Debugf("request: %+v", *req)
 	var err error
@@ -684,24 +814,34 @@ func (cp *ControllerPlugin) DeleteSnapshot(ctx context.Context, req *csi.DeleteS
 	}
 	//////////////////////////////////////////////////////////////////////////////
 
+	if len(req.GetSnapshotId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Snapshot ID missing in request")
+	}
 	sd, err := jdrvr.NewSnapshotDescFromCSIID(req.GetSnapshotId())
 	if err != nil {
-		return nil, err
+		// Snapshot with id of wrong format can not exist
+		l.Warnf("Snapshot id %s has wrong format, there is nothing to delete", req.GetSnapshotId())
+		return &csi.DeleteSnapshotResponse{}, nil
 	}
 
 	ld := sd.GetVD()
 
-	rErr := cp.d.DeleteSnapshot(ctx, cp.pool, ld, sd)
+	// Deletion of the last snapshot might destroy hidden parent volume, hidden volume keeps CSIID of the original one
+	keys := []string{volumeLockKey(ld.CSIID()), snapshotLockKey(sd.CSIID())}
+	if err = cp.lockResources(keys...); err != nil {
+		return nil, err
+	}
+	defer cp.unlockResources(keys...)
+
+	rErr := cp.drv(ctx).DeleteSnapshot(ctx, cp.pool, ld, sd)
 
 	switch jrest.ErrCode(rErr) {
-	case jrest.RestErrorResourceBusy, jrest.RestErrorResourceBusySnapshotHasClones:
-		return nil, status.Error(codes.FailedPrecondition, err.Error())
-	case jrest.RestErrorResourceDNE:
+	case jrest.RestErrorResourceDNE, jrest.RestErrorResourceDNEVolume:
 		l.Warnf("snapshot %s do not exists", sd.Name())
 	case jrest.RestErrorOk:
-		l.Debugf("snapshot %s was deleted before", sd.Name())
+		l.Debugf("snapshot %s was deleted", sd.Name())
 	default:
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, restStatus(rErr, fmt.Sprintf("Unable to delete snapshot %s", sd.Name()), snapshotResource(sd))
 	}
 
 	return &csi.DeleteSnapshotResponse{}, nil
@@ -715,10 +855,14 @@ func (cp *ControllerPlugin) ListSnapshots(ctx context.Context, req *csi.ListSnap
 	var resp csi.ListSnapshotsResponse
 
 	l := cp.l.WithFields(log.Fields{
-		"request": "ListSnapshtos",
-		"func":    "ListSnapshots",
+		jcom.FieldRPC: "ListSnapshots",
+		"func":        "ListSnapshots",
 	})
 	ctx = jcom.WithLogger(ctx, l)
+	ctx, sErr := cp.withSecrets(ctx, req.GetSecrets())
+	if sErr != nil {
+		return nil, sErr
+	}
 
 	l.Debugf("Request: %+v", req)
 
@@ -739,15 +883,22 @@ func (cp *ControllerPlugin) ListSnapshots(ctx context.Context, req *csi.ListSnap
 	if len(sourceVolumeId) > 0 && len(snapshotId) == 0 {
 		l.Debugf("for volume %s", sourceVolumeId)
 		if vd, err := jdrvr.NewVolumeDescFromCSIID(sourceVolumeId); err != nil {
-			return nil, err
+			// Volume with id of wrong format can not exist, so it has no snapshots
+			l.Debugf("volume id %s have bad format: %s", sourceVolumeId, err)
+			return &resp, nil
 		} else {
-			if snapList, ts, rErr := cp.d.ListVolumeSnapshots(ctx, cp.pool, vd, int(maxEnt), *token); rErr != nil {
-				return nil, status.Errorf(codes.Internal, "Unable to complete listing request: %s", rErr.Error())
+			if snapList, ts, rErr := cp.drv(ctx).ListVolumeSnapshots(ctx, cp.pool, vd, int(maxEnt), *token); rErr != nil {
+				switch jrest.ErrCode(rErr) {
+				case jrest.RestErrorResourceDNE, jrest.RestErrorResourceDNEVolume:
+					l.Debugf("volume %s do not exists", vd.Name())
+					return &resp, nil
+				}
+				return nil, restStatus(rErr, "Unable to complete listing request", volumeResource(vd))
 			} else {
 				if ts != nil {
 					resp.NextToken = ts.Token()
 				}
-				if err = completeListResponseFromVolumeSnapshot(ctx, &resp, snapList, vd); err != nil {
+				if err = completeListResponseFromVolumeSnapshot(ctx, &resp, snapList, vd, cp.naming); err != nil {
 					return nil, err
 				} else {
 					return &resp, nil
@@ -756,17 +907,23 @@ func (cp *ControllerPlugin) ListSnapshots(ctx context.Context, req *csi.ListSnap
 		}
 	} else if len(snapshotId) > 0 {
 		if sd, err := jdrvr.NewSnapshotDescFromCSIID(snapshotId); err != nil {
-			return nil, err
+			// Snapshot with id of wrong format can not exist
+			l.Debugf("snapshot id %s have bad format: %s", snapshotId, err)
+			return &resp, nil
 		} else {
 			ld := sd.GetVD()
 			if len(sourceVolumeId) > 0 && sourceVolumeId != ld.CSIID() {
 				return nil, status.Errorf(codes.FailedPrecondition, "Specified snapshot %s with id %s is not related to volume %s with id %s", sd.Name(), sd.CSIID(), ld.Name(), ld.CSIID())
 			}
-			if snap, rErr := cp.d.GetSnapshot(ctx, cp.pool, ld, sd); rErr != nil {
-				if jrest.ErrCode(rErr) == jrest.RestErrorResourceDNE {
-					return nil, status.Error(codes.InvalidArgument, rErr.Error())
+			if snap, rErr := cp.drv(ctx).GetSnapshot(ctx, cp.pool, ld, sd); rErr != nil {
+				switch jrest.ErrCode(rErr) {
+				case jrest.RestErrorResourceDNE, jrest.RestErrorResourceDNEVolume:
+					// Listing of snapshot that does not exist is empty
+					l.Debugf("snapshot %s do not exists", sd.Name())
+					return &resp, nil
 				}
-
+				return nil, restStatus(rErr, fmt.Sprintf("Unable to get snapshot %s", sd.Name()), snapshotResource(sd))
+			} else if cp.naming.Owns(ld.Name(), snap.UserProperties) {
 				entry := csi.ListSnapshotsResponse_Entry{
 					Snapshot: &csi.Snapshot{
 						SnapshotId:     sd.CSIID(),
@@ -780,51 +937,89 @@ func (cp *ControllerPlugin) ListSnapshots(ctx context.Context, req *csi.ListSnap
 		}
 
 		l.Debugf("get snapshot %s", snapshotId)
+		return &resp, nil
 	} else {
 		l.Debugln("listing all snapshots")
-		if snapList, ts, rErr := cp.d.ListAllSnapshots(ctx, cp.pool, int(maxEnt), *token); err != nil {
-			return nil, status.Errorf(codes.Internal, "Unable to complete listing request: %s", rErr.Error())
+		if snapList, ts, rErr := cp.drv(ctx).ListAllSnapshots(ctx, cp.pool, int(maxEnt), *token); rErr != nil {
+			return nil, restStatus(rErr, "Unable to complete listing request")
 		} else {
 			if ts != nil {
 				resp.NextToken = ts.Token()
 			}
-			if err = completeListResponseFromSnapshotShort(ctx, &resp, snapList); err != nil {
+			if err = completeListResponseFromSnapshotShort(ctx, &resp, snapList, cp.naming); err != nil {
 				return nil, err
 			} else {
 				return &resp, nil
 			}
 		}
 	}
-	return nil, nil
+}
+
+// SnapshotMetadata gives original name and kubernetes metadata of snapshot
+//
+// CSI snapshot structure have no place for it, so it is provided separately
+func (cp *ControllerPlugin) SnapshotMetadata(ctx context.Context, snapshotID string) (jdrvr.Metadata, error) {
+
+	l := cp.l.WithFields(log.Fields{
+		jcom.FieldRPC: "SnapshotMetadata",
+		"func":        "SnapshotMetadata",
+		"section":     "controller",
+	})
+	ctx = jcom.WithLogger(ctx, l)
+
+	sd, err := jdrvr.NewSnapshotDescFromCSIID(snapshotID)
+	if err != nil {
+		return nil, err
+	}
+
+	snap, rErr := cp.drv(ctx).GetSnapshot(ctx, cp.pool, sd.GetVD(), sd)
+
+	if rErr != nil {
+		return nil, restStatus(rErr, fmt.Sprintf("Unable to get snapshot %s", sd.Name()), snapshotResource(sd))
+	}
+	return jdrvr.NewMetadataFromUserProperties(snap.UserProperties), nil
 }
 
 // ControllerPublishVolume create iscsi target for the volume
 func (cp *ControllerPlugin) ControllerPublishVolume(ctx context.Context, req *csi.ControllerPublishVolumeRequest) (*csi.ControllerPublishVolumeResponse, error) {
 
 	l := cp.l.WithFields(log.Fields{
-		"request": "ControllerPublishVolume",
-		"func":    "ControllerPublishVolume",
+		jcom.FieldRPC:      "ControllerPublishVolume",
+		jcom.FieldVolumeID: req.GetVolumeId(),
+		"func":             "ControllerPublishVolume",
 	})
 	ctx = jcom.WithLogger(ctx, l)
+	ctx, sErr := cp.withSecrets(ctx, req.GetSecrets())
+	if sErr != nil {
+		return nil, sErr
+	}
 
 	l.Debugf("Publish volume request %+v", req)
 	var err error
 
-	vd, err := jdrvr.NewVolumeDescFromCSIID(req.GetVolumeId())
-	if err != nil {
-		return nil, err
-	}
 	roMode := req.GetReadonly()
 
 	//////////////////////////////////////////////////////////////////////////////
 	/// Checks
 
+	if len(req.GetVolumeId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Volume ID missing in request")
+	}
+	if len(req.GetNodeId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Node ID missing in request")
+	}
+
 	// TODO: verify capabiolity
 	caps := req.GetVolumeCapability()
 	if caps == nil {
 		return nil, status.Error(codes.InvalidArgument, "Volume Capabilities missing in request")
 	}
 
+	vd, err := volumeFromID(req.GetVolumeId())
+	if err != nil {
+		return nil, err
+	}
+
 	if false == cp.capSupported(csi.ControllerServiceCapability_RPC_PUBLISH_UNPUBLISH_VOLUME) {
 		err = status.Errorf(codes.Internal, "Capability is not supported.")
 		l.Warnf("Unable to publish volume req: %v", req)
@@ -833,13 +1028,19 @@ func (cp *ControllerPlugin) ControllerPublishVolume(ctx context.Context, req *cs
 
 	//////////////////////////////////////////////////////////////////////////////
 
-	iscsiContext, rErr := cp.d.PublishVolume(ctx, cp.pool, vd, cp.iqnPrefix, roMode)
+	if err = cp.lockVolume(vd.CSIID()); err != nil {
+		return nil, err
+	}
+	defer cp.unlockVolume(vd.CSIID())
+
+	iscsiContext, rErr := cp.drv(ctx).PublishVolume(ctx, cp.pool, vd, cp.iqnPrefix, roMode)
 
 	switch jrest.ErrCode(rErr) {
 	case jrest.RestErrorOk:
 
-		(*iscsiContext)["addrs"] = fmt.Sprintf(strings.Join(cp.iscsiEndpointCfg.Addrs, ","))
-		(*iscsiContext)["port"] = fmt.Sprintf("%d", cp.iscsiEndpointCfg.Port)
+		iscsiCfg := cp.iscsiCfg()
+		(*iscsiContext)["addrs"] = fmt.Sprintf(strings.Join(iscsiCfg.Addrs, ","))
+		(*iscsiContext)["port"] = fmt.Sprintf("%d", iscsiCfg.Port)
 
 		resp := csi.ControllerPublishVolumeResponse{
 			PublishContext: *iscsiContext,
@@ -847,29 +1048,11 @@ func (cp *ControllerPlugin) ControllerPublishVolume(ctx context.Context, req *cs
 		// TODO: Delete this log
 		l.Debugf("Publish Response %+v", resp)
 		return &resp, nil
-	case jrest.RestErrorResourceBusy:
-		// According to specification from
-		return nil, status.Error(codes.FailedPrecondition, rErr.Error())
-	case jrest.RestErrorFailureUnknown:
-		err = status.Errorf(codes.Internal, rErr.Error())
-		return nil, err
-	case jrest.RestErrorResourceExists:
+	default:
 		// TODO: handle	FAILED_PRECONDITION
 		// Indicates that a volume corresponding to the specified volume_id has already been published at another node and does not have MULTI_NODE volume capability.
 		// If this error code is returned, the Plugin SHOULD specify the node_id of the node at which the volume is published as part of the gRPC status.message.
-		// TODO: handle ALREADY_EXISTS
-		// Indicates that a volume corresponding to the specified volume_id has already been published at the node corresponding to the specified node_id but is
-		// incompatible with the specified volume_capability or readonly flag .
-		err = status.Errorf(codes.AlreadyExists, rErr.Error())
-		return nil, err
-	case jrest.RestErrorResourceDNE, jrest.RestErrorResourceDNEVolume:
-		msg := fmt.Sprintf("Resource not found: %s", rErr.Error())
-		err = status.Errorf(codes.NotFound, msg)
-		return nil, err
-
-	default:
-		err = status.Errorf(codes.Internal, "Unknown internal error")
-		return nil, err
+		return nil, restStatus(rErr, fmt.Sprintf("Unable to publish volume %s", vd.Name()), volumeResource(vd))
 	}
 }
 
@@ -877,22 +1060,32 @@ func (cp *ControllerPlugin) ControllerPublishVolume(ctx context.Context, req *cs
 func (cp *ControllerPlugin) ControllerUnpublishVolume(ctx context.Context, req *csi.ControllerUnpublishVolumeRequest) (*csi.ControllerUnpublishVolumeResponse, error) {
 
 	l := cp.l.WithFields(log.Fields{
-		"request": "ControllerUnpublishVolume",
-		"func":    "ControllerUnpublishVolume",
+		jcom.FieldRPC:      "ControllerUnpublishVolume",
+		jcom.FieldVolumeID: req.GetVolumeId(),
+		"func":             "ControllerUnpublishVolume",
 	})
 	ctx = jcom.WithLogger(ctx, l)
+	ctx, sErr := cp.withSecrets(ctx, req.GetSecrets())
+	if sErr != nil {
+		return nil, sErr
+	}
 
 	l.Debugf("UnpublishVolume req: %+v", req)
 
 	if vd, err := jdrvr.NewVolumeDescFromCSIID(req.GetVolumeId()); err != nil {
 		return nil, err
 	} else {
-		rErr := cp.d.UnpublishVolume(ctx, cp.pool, cp.iqnPrefix, vd)
+		if err := cp.lockVolume(vd.CSIID()); err != nil {
+			return nil, err
+		}
+		defer cp.unlockVolume(vd.CSIID())
+
+		rErr := cp.drv(ctx).UnpublishVolume(ctx, cp.pool, cp.iqnPrefix, vd)
 		switch jrest.ErrCode(rErr) {
 		case jrest.RestErrorOk, jrest.RestErrorResourceDNE, jrest.RestErrorResourceDNETarget:
 			return &csi.ControllerUnpublishVolumeResponse{}, nil
 		default:
-			return nil, status.Errorf(codes.Internal, "Unable to unpublish volume %s because of %s", vd.Name(), rErr.Error())
+			return nil, restStatus(rErr, fmt.Sprintf("Unable to unpublish volume %s", vd.Name()), volumeResource(vd))
 		}
 	}
 }
@@ -901,27 +1094,28 @@ func (cp *ControllerPlugin) ControllerUnpublishVolume(ctx context.Context, req *
 func (cp *ControllerPlugin) ValidateVolumeCapabilities(ctx context.Context, req *csi.ValidateVolumeCapabilitiesRequest) (*csi.ValidateVolumeCapabilitiesResponse, error) {
 
 	l := cp.l.WithFields(log.Fields{
-		"request": "ValidateVolumeCapabilities",
-		"func":    "ValidateVolumeCapabilitiese",
+		jcom.FieldRPC:      "ValidateVolumeCapabilities",
+		jcom.FieldVolumeID: req.GetVolumeId(),
+		"func":             "ValidateVolumeCapabilitiese",
 	})
 
 	ctx = jcom.WithLogger(ctx, l)
+	ctx, sErr := cp.withSecrets(ctx, req.GetSecrets())
+	if sErr != nil {
+		return nil, sErr
+	}
 	supported := true
 
-	vd, err := jdrvr.NewVolumeDescFromCSIID(req.GetVolumeId())
+	vd, err := volumeFromID(req.GetVolumeId())
 	if err != nil {
 		return nil, err
 	}
 
-	_, rErr := cp.d.GetVolume(ctx, cp.pool, vd)
-	switch jrest.ErrCode(rErr) {
-	case jrest.RestErrorOk:
-		l.Debugf("volume %s present", vd.Name())
-	case jrest.RestErrorResourceDNE, jrest.RestErrorResourceDNEVolume:
-		return nil, status.Error(codes.NotFound, rErr.Error())
-	default:
-		return nil, status.Error(codes.Internal, fmt.Sprintf("Unable to verify volume %s because of %s ", vd.Name(), rErr.Error()))
+	_, rErr := cp.drv(ctx).GetVolume(ctx, cp.pool, vd)
+	if rErr != nil {
+		return nil, restStatus(rErr, fmt.Sprintf("Unable to verify volume %s", vd.Name()), volumeResource(vd))
 	}
+	l.Debugf("volume %s present", vd.Name())
 
 	vcap := req.GetVolumeCapabilities()
 
@@ -944,17 +1138,16 @@ func (cp *ControllerPlugin) ValidateVolumeCapabilities(ctx context.Context, req
 	}
 
 	if supported != true {
+		return &csi.ValidateVolumeCapabilitiesResponse{Message: "Requested access mode is not supported"}, nil
 	}
 
 	vCtx := req.GetVolumeContext()
-	if vcap == nil {
-		return nil, status.Error(codes.InvalidArgument, "Volume context where not specified")
-	}
 
 	resp := &csi.ValidateVolumeCapabilitiesResponse{
 		Confirmed: &csi.ValidateVolumeCapabilitiesResponse_Confirmed{
-			VolumeCapabilities: cp.vCap,
+			VolumeCapabilities: vcap,
 			VolumeContext:      vCtx,
+			Parameters:         req.GetParameters(),
 		},
 	}
 
@@ -976,13 +1169,41 @@ func (cp *ControllerPlugin) ControllerGetVolume(ctx context.Context, in *csi.Con
 	return nil, status.Error(codes.Unimplemented, "")
 }
 
+// Ready checks that controller is able to authenticate against JovianDSS and configured pool exists
+func (cp *ControllerPlugin) Ready(ctx context.Context) error {
+	l := cp.le.WithFields(log.Fields{
+		"func":    "Ready",
+		"section": "controller",
+	})
+	ctx = jcom.WithLogger(ctx, l)
+
+	if !cp.hasDefaultCreds() {
+		// Credentials come with requests, there is nothing to check connection with
+		return nil
+	}
+	if _, rErr := cp.d.GetPool(ctx, cp.pool); rErr != nil {
+		return fmt.Errorf("unable to get pool %s: %s", cp.pool, rErr.Error())
+	}
+	return nil
+}
+
 // GetCapacity gets storage capacity
 func (cp *ControllerPlugin) GetCapacity(ctx context.Context, req *csi.GetCapacityRequest) (*csi.GetCapacityResponse, error) {
 
+	l := cp.l.WithFields(log.Fields{
+		jcom.FieldRPC: "GetCapacity",
+		"func":        "GetCapacity",
+	})
+	ctx = jcom.WithLogger(ctx, l)
+	ctx, sErr := cp.withConfigCreds(ctx)
+	if sErr != nil {
+		return nil, sErr
+	}
+
 	// TODO: add capability check
-	pool, rErr := cp.d.GetPool(ctx, cp.pool)
+	pool, rErr := cp.drv(ctx).GetPool(ctx, cp.pool)
 	if rErr != nil {
-		return nil, status.Error(codes.Internal, rErr.Error())
+		return nil, restStatus(rErr, fmt.Sprintf("Unable to get pool %s", cp.pool))
 	}
 	var rsp csi.GetCapacityResponse
 
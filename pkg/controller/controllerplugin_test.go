@@ -0,0 +1,346 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	jcom "joviandss-kubernetescsi/pkg/common"
+	jdrvr "joviandss-kubernetescsi/pkg/driver"
+	"joviandss-kubernetescsi/pkg/rest/fake"
+)
+
+const testPool = "Pool-0"
+
+// slowRequest is how long storage holds request of operation that runs first
+const slowRequest = 500 * time.Millisecond
+
+// testController gives controller connected to fake storage
+func testController(t *testing.T) (*ControllerPlugin, *fake.Server) {
+	t.Helper()
+
+	s := fake.NewServer(testPool)
+	t.Cleanup(s.Close)
+	s.SetCredentials("admin", "admin")
+
+	cfg := jcom.JovianDSSCfg{
+		LLevel:          "error",
+		LDest:           os.DevNull,
+		Pool:            testPool,
+		RestEndpointCfg: s.EndpointCfg(),
+	}
+	var cp ControllerPlugin
+	if err := SetupControllerPlugin(&cp, &cfg); err != nil {
+		t.Fatalf("unable to setup controller: %s", err)
+	}
+	return &cp, s
+}
+
+func testVolumeCaps() []*csi.VolumeCapability {
+	return []*csi.VolumeCapability{{
+		AccessType: &csi.VolumeCapability_Mount{Mount: &csi.VolumeCapability_MountVolume{}},
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER},
+	}}
+}
+
+func createVolume(cp *ControllerPlugin, name string, source *csi.VolumeContentSource) error {
+	_, err := cp.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+		Name:                name,
+		CapacityRange:       &csi.CapacityRange{RequiredBytes: 1 << 30},
+		VolumeCapabilities:  testVolumeCaps(),
+		VolumeContentSource: source,
+	})
+	return err
+}
+
+// testVolume creates volume with snapshot, it gives CSI IDs of both
+func testVolume(t *testing.T, cp *ControllerPlugin, name string) (string, string) {
+	t.Helper()
+
+	rsp, err := cp.CreateVolume(context.Background(), &csi.CreateVolumeRequest{
+		Name:               name,
+		CapacityRange:      &csi.CapacityRange{RequiredBytes: 1 << 30},
+		VolumeCapabilities: testVolumeCaps(),
+	})
+	if err != nil {
+		t.Fatalf("unable to create volume %s: %s", name, err)
+	}
+	srsp, err := cp.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{
+		SourceVolumeId: rsp.GetVolume().GetVolumeId(),
+		Name:           name + "-snap",
+	})
+	if err != nil {
+		t.Fatalf("unable to create snapshot of volume %s: %s", name, err)
+	}
+	return rsp.GetVolume().GetVolumeId(), srsp.GetSnapshot().GetSnapshotId()
+}
+
+// volumePath gives pattern of storage path of volume with given CSI ID
+func volumePath(t *testing.T, vID string) string {
+	t.Helper()
+
+	vd, err := jdrvr.NewVolumeDescFromCSIID(vID)
+	if err != nil {
+		t.Fatalf("unable to parse volume id %s: %s", vID, err)
+	}
+	return "/volumes/" + regexp.QuoteMeta(vd.Path())
+}
+
+// snapshotPath gives pattern of storage path of snapshot with given CSI ID
+func snapshotPath(t *testing.T, sID string) string {
+	t.Helper()
+
+	sd, err := jdrvr.NewSnapshotDescFromCSIID(sID)
+	if err != nil {
+		t.Fatalf("unable to parse snapshot id %s: %s", sID, err)
+	}
+	return "/volumes/" + regexp.QuoteMeta(sd.GetVD().Path()) + "/snapshots/" + regexp.QuoteMeta(sd.SDS())
+}
+
+// inFlight starts operation and waits till it gets stuck on slowed down storage request
+func inFlight(t *testing.T, s *fake.Server, method, path string, op func() error) <-chan error {
+	t.Helper()
+
+	re := regexp.MustCompile(path + `$`)
+	s.InjectFault(fake.Fault{Method: method, Path: re, Times: 1, Delay: slowRequest})
+
+	sent := len(s.Requests())
+	done := make(chan error, 1)
+	go func() { done <- op() }()
+
+	for deadline := time.Now().Add(slowRequest); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		for _, r := range s.Requests()[sent:] {
+			if m, p, _ := strings.Cut(r, " "); m == method && re.MatchString(p) {
+				return done
+			}
+		}
+	}
+	t.Fatalf("operation did not send %s %s to storage", method, path)
+	return nil
+}
+
+func TestConcurrentOperations(t *testing.T) {
+	type ids struct {
+		vol, snap, other string
+	}
+
+	cases := []struct {
+		name     string
+		method   string
+		path     func(t *testing.T, id ids) string
+		first    func(cp *ControllerPlugin, id ids) error
+		second   func(cp *ControllerPlugin, id ids) error
+		expected codes.Code
+	}{
+		{
+			name:   "snapshot of volume being deleted",
+			method: http.MethodDelete,
+			path:   func(t *testing.T, id ids) string { return volumePath(t, id.vol) },
+			first: func(cp *ControllerPlugin, id ids) error {
+				_, err := cp.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: id.vol})
+				return err
+			},
+			second: func(cp *ControllerPlugin, id ids) error {
+				_, err := cp.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{SourceVolumeId: id.vol, Name: "late"})
+				return err
+			},
+			expected: codes.Aborted,
+		},
+		{
+			name:   "deletion of volume being snapshotted",
+			method: http.MethodPost,
+			path:   func(t *testing.T, id ids) string { return volumePath(t, id.vol) + "/snapshots" },
+			first: func(cp *ControllerPlugin, id ids) error {
+				_, err := cp.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{SourceVolumeId: id.vol, Name: "early"})
+				return err
+			},
+			second: func(cp *ControllerPlugin, id ids) error {
+				_, err := cp.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: id.vol})
+				return err
+			},
+			expected: codes.Aborted,
+		},
+		{
+			name:   "deletion of volume being cloned",
+			method: http.MethodPost,
+			path:   func(t *testing.T, id ids) string { return volumePath(t, id.vol) + "/clone" },
+			first: func(cp *ControllerPlugin, id ids) error {
+				return createVolume(cp, "clone", &csi.VolumeContentSource{
+					Type: &csi.VolumeContentSource_Volume{Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: id.vol}},
+				})
+			},
+			second: func(cp *ControllerPlugin, id ids) error {
+				_, err := cp.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: id.vol})
+				return err
+			},
+			expected: codes.Aborted,
+		},
+		{
+			name:   "clone of volume being deleted by id of other form",
+			method: http.MethodDelete,
+			path:   func(t *testing.T, id ids) string { return volumePath(t, id.vol) },
+			first: func(cp *ControllerPlugin, id ids) error {
+				_, err := cp.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: id.vol})
+				return err
+			},
+			second: func(cp *ControllerPlugin, id ids) error {
+				return createVolume(cp, "clone", &csi.VolumeContentSource{
+					Type: &csi.VolumeContentSource_Volume{Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: "vh_" + id.vol}},
+				})
+			},
+			expected: codes.Aborted,
+		},
+		{
+			name:   "restore of snapshot being deleted by id of other form",
+			method: http.MethodDelete,
+			path:   func(t *testing.T, id ids) string { return snapshotPath(t, id.snap) },
+			first: func(cp *ControllerPlugin, id ids) error {
+				_, err := cp.DeleteSnapshot(context.Background(), &csi.DeleteSnapshotRequest{SnapshotId: id.snap})
+				return err
+			},
+			second: func(cp *ControllerPlugin, id ids) error {
+				sd, err := jdrvr.NewSnapshotDescFromCSIID(id.snap)
+				if err != nil {
+					return err
+				}
+				// Volume section refers hidden counterpart of the volume
+				hID := sd.SDS() + "_" + base64.StdEncoding.EncodeToString([]byte("vh_"+id.vol))
+				return createVolume(cp, "restore", &csi.VolumeContentSource{
+					Type: &csi.VolumeContentSource_Snapshot{Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: hID}},
+				})
+			},
+			expected: codes.Aborted,
+		},
+		{
+			name:   "deletion of snapshot being restored",
+			method: http.MethodPost,
+			path:   func(t *testing.T, id ids) string { return volumePath(t, id.vol) + "/clone" },
+			first: func(cp *ControllerPlugin, id ids) error {
+				return createVolume(cp, "restore", &csi.VolumeContentSource{
+					Type: &csi.VolumeContentSource_Snapshot{Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: id.snap}},
+				})
+			},
+			second: func(cp *ControllerPlugin, id ids) error {
+				_, err := cp.DeleteSnapshot(context.Background(), &csi.DeleteSnapshotRequest{SnapshotId: id.snap})
+				return err
+			},
+			expected: codes.Aborted,
+		},
+		{
+			name:   "deletion of volume whose snapshot is being deleted",
+			method: http.MethodDelete,
+			path:   func(t *testing.T, id ids) string { return snapshotPath(t, id.snap) },
+			first: func(cp *ControllerPlugin, id ids) error {
+				_, err := cp.DeleteSnapshot(context.Background(), &csi.DeleteSnapshotRequest{SnapshotId: id.snap})
+				return err
+			},
+			second: func(cp *ControllerPlugin, id ids) error {
+				_, err := cp.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: id.vol})
+				return err
+			},
+			expected: codes.Aborted,
+		},
+		{
+			name:   "snapshot of other volume",
+			method: http.MethodDelete,
+			path:   func(t *testing.T, id ids) string { return volumePath(t, id.vol) },
+			first: func(cp *ControllerPlugin, id ids) error {
+				_, err := cp.DeleteVolume(context.Background(), &csi.DeleteVolumeRequest{VolumeId: id.vol})
+				return err
+			},
+			second: func(cp *ControllerPlugin, id ids) error {
+				_, err := cp.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{SourceVolumeId: id.other, Name: "late"})
+				return err
+			},
+			expected: codes.OK,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cp, s := testController(t)
+
+			var id ids
+			id.vol, id.snap = testVolume(t, cp, "vol")
+			id.other, _ = testVolume(t, cp, "other")
+
+			done := inFlight(t, s, c.method, c.path(t, id), func() error { return c.first(cp, id) })
+
+			if err := c.second(cp, id); status.Code(err) != c.expected {
+				t.Errorf("concurrent operation gave %v, expected %s", err, c.expected)
+			}
+			if err := <-done; err != nil {
+				t.Errorf("operation that started first failed: %s", err)
+			}
+		})
+	}
+}
+
+func TestLockResourcesTakesAllOrNothing(t *testing.T) {
+	cp, _ := testController(t)
+
+	if err := cp.lockResources(snapshotLockKey("s"), volumeLockKey("v")); err != nil {
+		t.Fatalf("unable to lock free resources: %s", err)
+	}
+	if err := cp.lockResources(volumeLockKey("v"), volumeLockKey("w")); status.Code(err) != codes.Aborted {
+		t.Errorf("locking taken volume gave %v, expected aborted", err)
+	}
+	// Failed attempt must not leave any of its keys taken
+	if err := cp.lockVolume("w"); err != nil {
+		t.Errorf("volume is left locked after failed attempt: %s", err)
+	}
+	cp.unlockVolume("w")
+
+	cp.unlockResources(volumeLockKey("v"), snapshotLockKey("s"))
+	if err := cp.lockResources(volumeLockKey("v"), snapshotLockKey("s")); err != nil {
+		t.Errorf("resources are not released: %s", err)
+	}
+}
+
+func TestCreateSnapshotNameIsUnique(t *testing.T) {
+	cp, _ := testController(t)
+
+	vID, sID := testVolume(t, cp, "vol")
+	oID, _ := testVolume(t, cp, "other")
+
+	// Repeated request gives the same snapshot
+	rsp, err := cp.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{SourceVolumeId: vID, Name: "vol-snap"})
+	if err != nil {
+		t.Fatalf("repeated snapshot creation failed: %s", err)
+	}
+	if id := rsp.GetSnapshot().GetSnapshotId(); id != sID {
+		t.Errorf("repeated snapshot creation gave snapshot %s, expected %s", id, sID)
+	}
+
+	// Storage would make snapshot with the same name for other volume
+	_, err = cp.CreateSnapshot(context.Background(), &csi.CreateSnapshotRequest{SourceVolumeId: oID, Name: "vol-snap"})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("snapshot with taken name for other volume gave %v, expected %s", err, codes.AlreadyExists)
+	}
+}
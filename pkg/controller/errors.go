@@ -0,0 +1,159 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	jdrvr "joviandss-kubernetescsi/pkg/driver"
+	jrest "joviandss-kubernetescsi/pkg/rest"
+)
+
+// errorDomain identifies the driver in ErrorInfo details of returned errors
+const errorDomain = "joviandss.csi.open-e.com"
+
+// Types of resources named in ResourceInfo details
+const (
+	resourceVolume          = "volume"
+	resourceSnapshot        = "snapshot"
+	resourceStorageVolume   = "joviandss/volume"
+	resourceStorageSnapshot = "joviandss/snapshot"
+	resourceStorageTarget   = "joviandss/target"
+)
+
+type restErrorMapping struct {
+	code   codes.Code
+	reason string
+}
+
+// restErrorCodes maps failures of JovianDSS requests to gRPC codes defined by CSI specification
+// and reasons provided in ErrorInfo
+var restErrorCodes = map[int]restErrorMapping{
+	jrest.RestErrorFailureUnknown:                 {codes.Internal, "FAILURE_UNKNOWN"},
+	jrest.RestErrorResourceBusy:                   {codes.FailedPrecondition, "RESOURCE_BUSY"},
+	jrest.RestErrorResourceExists:                 {codes.AlreadyExists, "RESOURCE_EXISTS"},
+	jrest.RestErrorRequestMalfunction:             {codes.Internal, "REQUEST_MALFUNCTION"},
+	jrest.RestErrorResourceDNE:                    {codes.NotFound, "RESOURCE_NOT_FOUND"},
+	jrest.RestErrorUnableToConnect:                {codes.Unavailable, "UNABLE_TO_CONNECT"},
+	jrest.RestErrorRPM:                            {codes.Internal, "RESPONSE_MALFUNCTION"},
+	jrest.RestErrorStorageFailureUnknown:          {codes.Internal, "STORAGE_FAILURE_UNKNOWN"},
+	jrest.RestErrorRequestTimeout:                 {codes.Unavailable, "REQUEST_TIMEOUT"},
+	jrest.RestErrorArgumentIncorrect:              {codes.InvalidArgument, "ARGUMENT_INCORRECT"},
+	jrest.RestErrorResourceBusySnapshotHasClones:  {codes.FailedPrecondition, "SNAPSHOT_HAS_CLONES"},
+	jrest.RestErrorResourceBusyVolumeHasSnapshots: {codes.FailedPrecondition, "VOLUME_HAS_SNAPSHOTS"},
+	jrest.RestErrorOutOfSpace:                     {codes.ResourceExhausted, "OUT_OF_SPACE"},
+	jrest.RestErrorResourceDNEVolume:              {codes.NotFound, "VOLUME_NOT_FOUND"},
+	jrest.RestErrorResourceDNETarget:              {codes.NotFound, "TARGET_NOT_FOUND"},
+	jrest.RestErrorRequestCanceled:                {codes.Canceled, "REQUEST_CANCELED"},
+	jrest.RestErrorDeadlineExceeded:               {codes.DeadlineExceeded, "DEADLINE_EXCEEDED"},
+	jrest.RestErrorServiceUnavailable:             {codes.Unavailable, "SERVICE_UNAVAILABLE"},
+	jrest.RestErrorCertificateInvalid:             {codes.FailedPrecondition, "CERTIFICATE_INVALID"},
+}
+
+// volumeResource names volume in error details
+func volumeResource(vd *jdrvr.VolumeDesc) *errdetails.ResourceInfo {
+	return &errdetails.ResourceInfo{
+		ResourceType: resourceVolume,
+		ResourceName: vd.CSIID(),
+		Description:  fmt.Sprintf("volume %s stored as %s", vd.Name(), vd.Path()),
+	}
+}
+
+// snapshotResource names snapshot in error details
+func snapshotResource(sd *jdrvr.SnapshotDesc) *errdetails.ResourceInfo {
+	return &errdetails.ResourceInfo{
+		ResourceType: resourceSnapshot,
+		ResourceName: sd.CSIID(),
+		Description:  fmt.Sprintf("snapshot %s stored as %s@%s", sd.Name(), sd.GetVD().Path(), sd.SDS()),
+	}
+}
+
+// storageResource names resource reported by JovianDSS in error details
+func storageResource(code int, name string) *errdetails.ResourceInfo {
+	rt := resourceStorageVolume
+	switch {
+	case code == jrest.RestErrorResourceDNETarget || strings.HasPrefix(name, "iqn."):
+		rt = resourceStorageTarget
+	case strings.Contains(name, "@"):
+		rt = resourceStorageSnapshot
+	}
+	return &errdetails.ResourceInfo{
+		ResourceType: rt,
+		ResourceName: name,
+		Description:  "reported by JovianDSS",
+	}
+}
+
+// restStatus converts failure of JovianDSS request to gRPC error
+//
+// msg describes operation that failed, it is followed by description of the failure.
+// Error carries ErrorInfo with data reported by JovianDSS and ResourceInfo
+// for every given resource and every resource named by JovianDSS
+func restStatus(rErr jrest.RestError, msg string, resources ...*errdetails.ResourceInfo) error {
+	if rErr == nil {
+		return nil
+	}
+
+	m, ok := restErrorCodes[rErr.GetCode()]
+	if !ok {
+		m = restErrorMapping{codes.Internal, "FAILURE_UNKNOWN"}
+	}
+
+	st := status.New(m.code, fmt.Sprintf("%s: %s", msg, rErr.Error()))
+
+	info := &errdetails.ErrorInfo{
+		Reason: m.reason,
+		Domain: errorDomain,
+		Metadata: map[string]string{
+			"code": strconv.Itoa(rErr.GetCode()),
+		},
+	}
+	if stat := rErr.Status(); stat != 0 {
+		info.Metadata["httpStatus"] = strconv.Itoa(stat)
+	}
+	if errno, ok := rErr.Errno(); ok {
+		info.Metadata["errno"] = strconv.Itoa(errno)
+	}
+	if class := rErr.Class(); len(class) > 0 {
+		info.Metadata["class"] = class
+	}
+	if rErr.Retryable() {
+		info.Metadata["retryable"] = "true"
+	}
+
+	details := append([]*errdetails.ResourceInfo{}, resources...)
+	for _, name := range rErr.Resources() {
+		details = append(details, storageResource(rErr.GetCode(), name))
+	}
+
+	ds, err := st.WithDetails(info)
+	for i := 0; err == nil && i < len(details); i++ {
+		ds, err = ds.WithDetails(details[i])
+	}
+	if err != nil {
+		// Details are nice to have, status without them still tells what happened
+		return st.Err()
+	}
+	return ds.Err()
+}
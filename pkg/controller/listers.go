@@ -34,7 +34,7 @@ import (
 	jrest "joviandss-kubernetescsi/pkg/rest"
 )
 
-func completeListResponseFromSnapshotShort(ctx context.Context, lsr *csi.ListSnapshotsResponse, snaps []jrest.ResourceSnapshotShort) (err error) {
+func completeListResponseFromSnapshotShort(ctx context.Context, lsr *csi.ListSnapshotsResponse, snaps []jrest.ResourceSnapshotShort, vn *jdrvr.VolumeNaming) (err error) {
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(log.Fields{
@@ -49,7 +49,7 @@ func completeListResponseFromSnapshotShort(ctx context.Context, lsr *csi.ListSna
 	for _, s := range snaps {
 		ts := timestamppb.New(s.Properties.Creation)
 
-		vd, err := jdrvr.NewVolumeDescFromVDS(s.Volume)
+		vd, err := jdrvr.NewVolumeDescFromPath(s.Volume)
 		if err != nil {
 			l.Warnf("Volume name has incompatible format %s", s.Volume)
 			continue
@@ -59,6 +59,9 @@ func completeListResponseFromSnapshotShort(ctx context.Context, lsr *csi.ListSna
 			l.Warnf("Snapshot name has incompatible format %s", s.Name)
 			continue
 		}
+		if !vn.Owns(vd.Name(), s.Properties.UserProperties) {
+			continue
+		}
 
 		entries[i] = &csi.ListSnapshotsResponse_Entry{
 			Snapshot: &csi.Snapshot{
@@ -75,7 +78,7 @@ func completeListResponseFromSnapshotShort(ctx context.Context, lsr *csi.ListSna
 	return nil
 }
 
-func completeListResponseFromVolumeSnapshot(ctx context.Context, lsr *csi.ListSnapshotsResponse, snaps []jrest.ResourceSnapshot, ld jdrvr.LunDesc) (err error) {
+func completeListResponseFromVolumeSnapshot(ctx context.Context, lsr *csi.ListSnapshotsResponse, snaps []jrest.ResourceSnapshot, ld jdrvr.LunDesc, vn *jdrvr.VolumeNaming) (err error) {
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(log.Fields{
@@ -86,7 +89,7 @@ func completeListResponseFromVolumeSnapshot(ctx context.Context, lsr *csi.ListSn
 
 	entries := make([]*csi.ListSnapshotsResponse_Entry, len(snaps))
 	lsr.Entries = entries
-	for i, s := range snaps {
+	for _, s := range snaps {
 		ts := timestamppb.New(s.Creation)
 
 		sd, err := jdrvr.NewSnapshotDescFromSDS(ld, s.Name)
@@ -94,6 +97,9 @@ func completeListResponseFromVolumeSnapshot(ctx context.Context, lsr *csi.ListSn
 			l.Warnf("Snapshot name has incompatible format %s", s.Name)
 			continue
 		}
+		if !vn.Owns(ld.Name(), s.UserProperties) {
+			continue
+		}
 
 		entries[i] = &csi.ListSnapshotsResponse_Entry{
 			Snapshot: &csi.Snapshot{
@@ -110,7 +116,7 @@ func completeListResponseFromVolumeSnapshot(ctx context.Context, lsr *csi.ListSn
 	return nil
 }
 
-func completeListResponseFromVolume(ctx context.Context, lsr *csi.ListVolumesResponse, vols []jrest.ResourceVolume) (err error) {
+func completeListResponseFromVolume(ctx context.Context, lsr *csi.ListVolumesResponse, vols []jrest.ResourceVolume, vn *jdrvr.VolumeNaming) (err error) {
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(log.Fields{
@@ -122,17 +128,27 @@ func completeListResponseFromVolume(ctx context.Context, lsr *csi.ListVolumesRes
 	var i = 0
 	for _, v := range vols {
 
-		vd, err := jdrvr.NewVolumeDescFromVDS(v.Name)
+		// Hidden volumes are deleted from the CSI point of view
+		if jdrvr.IsHiddenVDS(v.Name) {
+			continue
+		}
+
+		vd, err := jdrvr.NewVolumeDescFromPath(v.Path())
 		if err != nil {
-			l.Warnf("Volume name has incompatible format %s", v.Name)
+			l.Warnf("Volume name has incompatible format %s", v.Path())
+			continue
+		}
+		// Pool might be shared with other clusters
+		if !vn.Owns(vd.Name(), v.UserProperties) {
 			continue
 		}
 		var contentSource *csi.VolumeContentSource
 
 		osds := v.OriginSnapshot()
-		if len(osds) > 0 {
+		ovd, oerr := jdrvr.NewVolumeDescFromPath(v.OriginVolume())
+		if len(osds) > 0 && oerr == nil {
 			if jdrvr.IsSDS(osds) {
-				if sd, err := jdrvr.NewSnapshotDescFromSDS(vd, osds); err != nil {
+				if sd, err := jdrvr.NewSnapshotDescFromSDS(ovd, osds); err == nil {
 					contentSource = &csi.VolumeContentSource{
 						Type: &csi.VolumeContentSource_Snapshot{
 							Snapshot: &csi.VolumeContentSource_SnapshotSource{
@@ -142,16 +158,14 @@ func completeListResponseFromVolume(ctx context.Context, lsr *csi.ListVolumesRes
 					}
 				}
 			} else if jdrvr.IsVDS(osds) {
-				if vd, err := jdrvr.NewVolumeDescFromVDS(osds); err == nil {
-					contentSource = &csi.VolumeContentSource{
-						Type: &csi.VolumeContentSource_Volume{
-							Volume: &csi.VolumeContentSource_VolumeSource{
-								VolumeId: vd.CSIID(),
-							},
+				// Volume cloned from volume is made from intermediate snapshot
+				contentSource = &csi.VolumeContentSource{
+					Type: &csi.VolumeContentSource_Volume{
+						Volume: &csi.VolumeContentSource_VolumeSource{
+							VolumeId: ovd.CSIID(),
 						},
-					}
+					},
 				}
-
 			}
 		}
 
@@ -160,6 +174,7 @@ func completeListResponseFromVolume(ctx context.Context, lsr *csi.ListVolumesRes
 				CapacityBytes: v.GetSize(),
 				VolumeId:      vd.CSIID(),
 				ContentSource: contentSource,
+				VolumeContext: jdrvr.NewMetadataFromUserProperties(v.UserProperties),
 			},
 		}
 		i += 1
@@ -0,0 +1,88 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	jcom "joviandss-kubernetescsi/pkg/common"
+)
+
+// reconfigurable storage accepts new connection settings at runtime
+type reconfigurable interface {
+	Reconfigure(cfg *jcom.RestEndpointCfg) error
+}
+
+// iscsiCfg gives iSCSI endpoint config that is currently in use
+func (cp *ControllerPlugin) iscsiCfg() jcom.ISCSIEndpointCfg {
+	cp.cfgMu.RLock()
+	defer cp.cfgMu.RUnlock()
+	return cp.iscsiEndpointCfg
+}
+
+// Reload applies new configuration to running controller
+//
+// REST endpoint addresses, credentials and TLS settings as well as iSCSI portals are replaced,
+// endpoints created for credentials from CSI secrets are recreated with new settings on next use.
+// Pool, iqn prefix, naming and garbage collector settings define names of existing resources,
+// changes to them are only applied on restart. If new configuration is incorrect, previous one is kept
+func (cp *ControllerPlugin) Reload(cfg *jcom.JovianDSSCfg) error {
+	l := cp.le.WithFields(log.Fields{
+		"func": "Reload",
+	})
+
+	if len(cfg.RestEndpointCfg.Addrs) == 0 {
+		return fmt.Errorf("endpoint addresses are not provided")
+	}
+	if len(cfg.ISCSIEndpointCfg.Addrs) == 0 {
+		return fmt.Errorf("iscsi addresses are not provided")
+	}
+
+	if cfg.Pool != cp.pool {
+		l.Warnf("Pool change from %s to %s requires restart, keeping %s", cp.pool, cfg.Pool, cp.pool)
+	}
+	iscsiCfg := cfg.ISCSIEndpointCfg
+	if len(iscsiCfg.Iqn) == 0 {
+		iscsiCfg.Iqn = jcom.DefaultIqn
+	}
+	if iscsiCfg.Iqn != cp.iqnPrefix {
+		l.Warnf("Iqn change from %s to %s requires restart, keeping %s", cp.iqnPrefix, iscsiCfg.Iqn, cp.iqnPrefix)
+		iscsiCfg.Iqn = cp.iqnPrefix
+	}
+
+	re, ok := cp.re.(reconfigurable)
+	if !ok {
+		return fmt.Errorf("storage does not support reconfiguration")
+	}
+	if err := re.Reconfigure(&cfg.RestEndpointCfg); err != nil {
+		return err
+	}
+
+	cp.cfgMu.Lock()
+	cp.iscsiEndpointCfg = iscsiCfg
+	cp.restCfg = cfg.RestEndpointCfg
+	cp.defaultCreds = len(cfg.RestEndpointCfg.User) > 0
+	cp.cfgMu.Unlock()
+
+	cp.dropSecretDrivers()
+
+	l.Info("Configuration reloaded")
+	return nil
+}
@@ -0,0 +1,194 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package controller
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	jdrvr "joviandss-kubernetescsi/pkg/driver"
+	jrest "joviandss-kubernetescsi/pkg/rest"
+)
+
+// Keys of CSI secrets that carry JovianDSS REST credentials
+const (
+	SecretUser = "user"
+	SecretPass = "pass"
+)
+
+// maxSecretDrivers limits number of drivers kept for distinct credentials from secrets,
+// least recently used driver is dropped once limit is reached, so rotated passwords do not pile up
+const maxSecretDrivers = 16
+
+type driverContextKey struct{}
+
+type cachedDriver struct {
+	key   string
+	d     *jdrvr.CSIDriver
+	close func() // releases endpoint of the driver
+}
+
+// driverCache keeps drivers in order of use, it is not safe for concurrent use
+//
+// Endpoints of drivers that are dropped from cache are closed
+type driverCache struct {
+	size    int
+	order   *list.List // most recently used first
+	entries map[string]*list.Element
+}
+
+func newDriverCache(size int) *driverCache {
+	return &driverCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (dc *driverCache) get(key string) (*jdrvr.CSIDriver, bool) {
+	e, ok := dc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	dc.order.MoveToFront(e)
+	return e.Value.(*cachedDriver).d, true
+}
+
+func (dc *driverCache) add(key string, d *jdrvr.CSIDriver, close func()) {
+	dc.entries[key] = dc.order.PushFront(&cachedDriver{key: key, d: d, close: close})
+	for dc.order.Len() > dc.size {
+		e := dc.order.Back()
+		dc.order.Remove(e)
+		cd := e.Value.(*cachedDriver)
+		delete(dc.entries, cd.key)
+		cd.close()
+	}
+}
+
+// closeAll closes endpoints of all drivers, cache is not expected to be used afterwards
+func (dc *driverCache) closeAll() {
+	for e := dc.order.Front(); e != nil; e = e.Next() {
+		e.Value.(*cachedDriver).close()
+	}
+}
+
+// secretKey identifies credentials in cache of endpoints without keeping them in plain text
+func secretKey(user string, pass string) string {
+	sum := sha256.Sum256([]byte(user + "\x00" + pass))
+	return hex.EncodeToString(sum[:])
+}
+
+// withSecrets selects driver that serves request and stores it in context
+//
+// Driver connected with credentials from CSI secrets is used if request has them,
+// otherwise driver connected with credentials from config file is used
+func (cp *ControllerPlugin) withSecrets(ctx context.Context, secrets map[string]string) (context.Context, error) {
+	if len(secrets) == 0 {
+		if !cp.hasDefaultCreds() {
+			return nil, status.Error(codes.InvalidArgument, "JovianDSS credentials are not provided in request secrets nor in config")
+		}
+		return context.WithValue(ctx, driverContextKey{}, cp.d), nil
+	}
+
+	user, pass := secrets[SecretUser], secrets[SecretPass]
+	if len(user) == 0 || len(pass) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "Request secrets have to contain %s and %s", SecretUser, SecretPass)
+	}
+
+	d, err := cp.secretDriver(user, pass)
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, driverContextKey{}, d), nil
+}
+
+// withConfigCreds selects driver connected with credentials from config file
+// for requests that can not carry CSI secrets, like ListVolumes and GetCapacity
+func (cp *ControllerPlugin) withConfigCreds(ctx context.Context) (context.Context, error) {
+	if !cp.hasDefaultCreds() {
+		return nil, status.Error(codes.FailedPrecondition, "Request can not carry CSI secrets, it requires JovianDSS credentials in config file")
+	}
+	return context.WithValue(ctx, driverContextKey{}, cp.d), nil
+}
+
+// secretDriver gives cached driver connected with given credentials, driver is created on first use
+func (cp *ControllerPlugin) secretDriver(user string, pass string) (*jdrvr.CSIDriver, error) {
+	key := secretKey(user, pass)
+
+	cp.secretsMu.Lock()
+	defer cp.secretsMu.Unlock()
+
+	if d, ok := cp.secretDrivers.get(key); ok {
+		return d, nil
+	}
+
+	cp.cfgMu.RLock()
+	cfg := cp.restCfg
+	cp.cfgMu.RUnlock()
+	cfg.User, cfg.Pass = user, pass
+
+	l := cp.le.WithFields(log.Fields{
+		"func": "secretDriver",
+		"user": user,
+	})
+
+	var re jrest.RestEndpoint
+	if err := jrest.SetupEndpoint(&re, &cfg, l); err != nil {
+		return nil, status.Errorf(codes.Internal, "Unable to setup REST endpoint for credentials from secrets: %s", err)
+	}
+	d, err := jdrvr.NewJovianDSSCSIDriver(&re, l)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Unable to setup driver for credentials from secrets: %s", err)
+	}
+
+	l.Info("Created REST endpoint for credentials from secrets")
+	cp.secretDrivers.add(key, d, re.Close)
+	return d, nil
+}
+
+// dropSecretDrivers forgets and closes drivers created for credentials from secrets,
+// they are created again with actual endpoint config on next use
+func (cp *ControllerPlugin) dropSecretDrivers() {
+	cp.secretsMu.Lock()
+	prev := cp.secretDrivers
+	cp.secretDrivers = newDriverCache(maxSecretDrivers)
+	cp.secretsMu.Unlock()
+
+	prev.closeAll()
+}
+
+// drv gives driver selected for request by withSecrets
+func (cp *ControllerPlugin) drv(ctx context.Context) *jdrvr.CSIDriver {
+	if d, ok := ctx.Value(driverContextKey{}).(*jdrvr.CSIDriver); ok {
+		return d
+	}
+	return cp.d
+}
+
+// hasDefaultCreds reports if config file provides JovianDSS credentials
+func (cp *ControllerPlugin) hasDefaultCreds() bool {
+	cp.cfgMu.RLock()
+	defer cp.cfgMu.RUnlock()
+	return cp.defaultCreds
+}
@@ -0,0 +1,149 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSecretDriversAreShared(t *testing.T) {
+	cp, _ := testController(t)
+
+	first, err := cp.secretDriver("admin", "admin")
+	if err != nil {
+		t.Fatalf("unable to get driver: %s", err)
+	}
+	second, err := cp.secretDriver("admin", "admin")
+	if err != nil {
+		t.Fatalf("unable to get driver: %s", err)
+	}
+	if first != second {
+		t.Errorf("same credentials got different drivers")
+	}
+	if other, _ := cp.secretDriver("admin", "other"); other == first {
+		t.Errorf("different credentials got the same driver")
+	}
+}
+
+func TestSecretDriversAreBounded(t *testing.T) {
+	cp, _ := testController(t)
+
+	kept, err := cp.secretDriver("admin", "kept")
+	if err != nil {
+		t.Fatalf("unable to get driver: %s", err)
+	}
+	for i := 0; i < 2*maxSecretDrivers; i++ {
+		if _, err := cp.secretDriver("admin", fmt.Sprintf("pass-%d", i)); err != nil {
+			t.Fatalf("unable to get driver: %s", err)
+		}
+		// Driver that is in use is not dropped
+		if _, err := cp.secretDriver("admin", "kept"); err != nil {
+			t.Fatalf("unable to get driver: %s", err)
+		}
+	}
+
+	if n := cp.secretDrivers.order.Len(); n != maxSecretDrivers {
+		t.Errorf("%d drivers are kept, expected %d", n, maxSecretDrivers)
+	}
+	if n := len(cp.secretDrivers.entries); n != maxSecretDrivers {
+		t.Errorf("%d drivers are indexed, expected %d", n, maxSecretDrivers)
+	}
+	if d, _ := cp.secretDriver("admin", "kept"); d != kept {
+		t.Errorf("recently used driver is dropped")
+	}
+	if _, ok := cp.secretDrivers.get(secretKey("admin", "pass-0")); ok {
+		t.Errorf("least recently used driver is kept")
+	}
+}
+
+func TestWithSecrets(t *testing.T) {
+	cp, _ := testController(t)
+
+	cases := []struct {
+		name     string
+		secrets  map[string]string
+		expected codes.Code
+	}{
+		{"no secrets", nil, codes.OK},
+		{"credentials", map[string]string{SecretUser: "admin", SecretPass: "admin"}, codes.OK},
+		{"no password", map[string]string{SecretUser: "admin"}, codes.InvalidArgument},
+		{"no user", map[string]string{SecretPass: "admin"}, codes.InvalidArgument},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, err := cp.withSecrets(context.Background(), c.secrets)
+			if status.Code(err) != c.expected {
+				t.Fatalf("got %v, expected %s", err, c.expected)
+			}
+			if err != nil {
+				return
+			}
+			if len(c.secrets) == 0 && cp.drv(ctx) != cp.d {
+				t.Errorf("request without secrets is not served by driver from config")
+			}
+			if len(c.secrets) > 0 && cp.drv(ctx) == cp.d {
+				t.Errorf("request with secrets is served by driver from config")
+			}
+		})
+	}
+}
+
+func TestDroppedSecretDriversAreClosed(t *testing.T) {
+	closed := map[string]bool{}
+	closer := func(key string) func() {
+		return func() { closed[key] = true }
+	}
+
+	dc := newDriverCache(2)
+	for _, key := range []string{"first", "second", "third"} {
+		dc.add(key, nil, closer(key))
+	}
+	if !closed["first"] {
+		t.Errorf("evicted driver is not closed")
+	}
+	if closed["second"] || closed["third"] {
+		t.Errorf("cached driver is closed")
+	}
+
+	// Reload drops all cached drivers
+	cp, _ := testController(t)
+	cp.secretDrivers = dc
+	cp.dropSecretDrivers()
+	if !closed["second"] || !closed["third"] {
+		t.Errorf("drivers dropped on reload are not closed")
+	}
+}
+
+func TestRequestsWithoutSecretsRequireConfigCredentials(t *testing.T) {
+	cp, _ := testController(t)
+	cp.defaultCreds = false
+
+	if _, err := cp.ListVolumes(context.Background(), &csi.ListVolumesRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("listing volumes without credentials gave %v, expected %s", err, codes.FailedPrecondition)
+	}
+	if _, err := cp.GetCapacity(context.Background(), &csi.GetCapacityRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("getting capacity without credentials gave %v, expected %s", err, codes.FailedPrecondition)
+	}
+}
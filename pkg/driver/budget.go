@@ -0,0 +1,67 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package driver
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// maximal time kept aside from request deadline for clean up of multi step operation
+	maxCleanupReserve = 10 * time.Second
+
+	// time given to clean up that is done after request was canceled or timed out
+	cleanupTimeout = 30 * time.Second
+)
+
+// stepsContext limits deadline of multi step operation,
+// so that part of remaining time is left for clean up in case steps fail
+func stepsContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	dl, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	reserve := time.Until(dl) / 4
+	if reserve > maxCleanupReserve {
+		reserve = maxCleanupReserve
+	}
+	return context.WithDeadline(ctx, dl.Add(-reserve))
+}
+
+// detachedContext keeps values of parent context, but is not canceled along with it
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) { return }
+func (detachedContext) Done() <-chan struct{}                   { return nil }
+func (detachedContext) Err() error                              { return nil }
+
+// cleanupContext gives context for clean up that have to be done
+// even if request was canceled or its deadline is exceeded
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx.Err() == nil {
+		if dl, ok := ctx.Deadline(); !ok || time.Until(dl) > maxCleanupReserve {
+			return context.WithCancel(ctx)
+		}
+	}
+	return context.WithTimeout(detachedContext{ctx}, cleanupTimeout)
+}
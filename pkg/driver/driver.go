@@ -22,6 +22,7 @@ package driver
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -33,9 +34,15 @@ import (
 	jrest "joviandss-kubernetescsi/pkg/rest"
 )
 
+const (
+	// how many times target state is checked after volume is attached to it
+	targetWaitTries    = 3
+	targetWaitInterval = time.Second
+)
+
 // JovianDSS CSI plugin
 type CSIDriver struct {
-	re jrest.RestEndpoint
+	re jrest.StorageInterface
 	l  *logrus.Entry
 }
 
@@ -52,7 +59,7 @@ func (d *CSIDriver) cloneLUN(ctx context.Context, pool string, source LunDesc, c
 	if snap == nil {
 		var snapdata = jrest.CreateSnapshotDescriptor{SnapshotName: clone.VDS()}
 
-		if err := d.re.CreateSnapshot(ctx, pool, source.VDS(), &snapdata); err != nil {
+		if err := d.re.CreateSnapshot(ctx, pool, source.Path(), &snapdata); err != nil {
 			code := err.GetCode()
 			if code != jrest.RestErrorResourceExists {
 				return err
@@ -66,25 +73,51 @@ func (d *CSIDriver) cloneLUN(ctx context.Context, pool string, source LunDesc, c
 		sds = snap.sds
 	}
 
-	var clonedata = jrest.CloneVolumeDescriptor{Name: clone.VDS(), Snapshot: sds}
-	err := d.re.CreateClone(ctx, pool, source.VDS(), clonedata)
+	var clonedata = jrest.CloneVolumeDescriptor{Name: clone.Path(), Snapshot: sds, CreateParents: createParents(clone)}
+	err := d.re.CreateClone(ctx, pool, source.Path(), clonedata)
 	return err
 }
 
-func (d *CSIDriver) CreateVolume(ctx context.Context, pool string, nvd *VolumeDesc, volumeSize int64) jrest.RestError {
+// createParents requests creation of parent datasets for volumes that are not placed in pool root
+func createParents(ld LunDesc) *bool {
+	if ld.Path() == ld.VDS() {
+		return nil
+	}
+	cp := true
+	return &cp
+}
+
+// volumeProperties gives properties that keep metadata of the new volume
+func volumeProperties(md Metadata) *jrest.CreateVolumeProperties {
+	up := md.UserProperties()
+	if len(up) == 0 {
+		return nil
+	}
+	return &jrest.CreateVolumeProperties{User: up}
+}
+
+func (d *CSIDriver) CreateVolume(ctx context.Context, pool string, nvd *VolumeDesc, volumeSize int64, md Metadata) jrest.RestError {
 
 	vd := jrest.CreateVolumeDescriptor{
-		Name: nvd.VDS(),
-		Size: fmt.Sprintf("%d", volumeSize),
+		Name:          nvd.Path(),
+		Size:          fmt.Sprintf("%d", volumeSize),
+		CreateParents: createParents(nvd),
+		Properties:    volumeProperties(md),
 	}
 
 	return d.re.CreateVolume(ctx, pool, vd)
 }
 
-func (d *CSIDriver) CreateVolumeFromSnapshot(ctx context.Context, pool string, sd *SnapshotDesc, nvd *VolumeDesc) jrest.RestError {
+func (d *CSIDriver) CreateVolumeFromSnapshot(ctx context.Context, pool string, sd *SnapshotDesc, nvd *VolumeDesc, md Metadata) jrest.RestError {
+
+	var clonedata = jrest.CloneVolumeDescriptor{Name: nvd.Path(), Snapshot: sd.SDS(), CreateParents: createParents(nvd), Properties: volumeProperties(md)}
+	err := d.re.CreateClone(ctx, pool, sd.ld.Path(), clonedata)
 
-	var clonedata = jrest.CloneVolumeDescriptor{Name: nvd.VDS(), Snapshot: sd.SDS()}
-	return d.re.CreateClone(ctx, pool, sd.ld.VDS(), clonedata)
+	// Source volume might be hidden after deletion
+	if isDNE(err) && !IsHiddenVDS(sd.ld.VDS()) {
+		return d.re.CreateClone(ctx, pool, sd.hidden().ld.Path(), clonedata)
+	}
+	return err
 }
 
 func (d *CSIDriver) deleteIntermediateSnapshot(ctx context.Context, pool string, vds string, sds string) (err jrest.RestError) {
@@ -142,7 +175,8 @@ func (d *CSIDriver) deleteIntermediateSnapshot(ctx context.Context, pool string,
 //	- pool pool name
 //	- vd source volume descripto
 //	- nvd new volume desctiptor
-func (d *CSIDriver) CreateVolumeFromVolume(ctx context.Context, pool string, vd *VolumeDesc, nvd *VolumeDesc) (err jrest.RestError) {
+//	- md metadata of new volume
+func (d *CSIDriver) CreateVolumeFromVolume(ctx context.Context, pool string, vd *VolumeDesc, nvd *VolumeDesc, md Metadata) (err jrest.RestError) {
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(logrus.Fields{
@@ -150,25 +184,41 @@ func (d *CSIDriver) CreateVolumeFromVolume(ctx context.Context, pool string, vd
 		"section": "driver",
 	})
 
+	// Part of the time is kept aside to remove intermediate snapshot if cloning fails
+	sctx, cancel := stepsContext(ctx)
+	defer cancel()
+
+	cleanup := func() {
+		cctx, ccancel := cleanupContext(ctx)
+		defer ccancel()
+		d.deleteIntermediateSnapshot(cctx, pool, vd.Path(), nvd.VDS())
+	}
+
 	var snapdata = jrest.CreateSnapshotDescriptor{SnapshotName: nvd.VDS()}
 
-	if err := d.re.CreateSnapshot(ctx, pool, vd.VDS(), &snapdata); err != nil {
+	if err := d.re.CreateSnapshot(sctx, pool, vd.Path(), &snapdata); err != nil {
 		code := err.GetCode()
 		// We are not able to create this snapshot for some reason
 
 		// Probably it was already created
 		if code == jrest.RestErrorResourceExists {
 
-			d.deleteIntermediateSnapshot(ctx, pool, vd.VDS(), nvd.VDS())
+			cleanup()
 		}
 		return err
 	}
 
-	var clonedata = jrest.CloneVolumeDescriptor{Name: nvd.VDS(), Snapshot: nvd.VDS()}
-	if err = d.re.CreateClone(ctx, pool, vd.VDS(), clonedata); err != nil {
-		l.Warnf("Unable to create volume %s from snapshot %s of volume %s, because of error %+v. Removing intermediate snapshot", nvd.VDS(), nvd.VDS(), vd.VDS(), err.Error())
+	if err = jrest.ContextError(sctx); err != nil {
+		l.Warnf("No time left to create volume %s from volume %s. Removing intermediate snapshot", nvd.Path(), vd.Path())
+		cleanup()
+		return err
+	}
+
+	var clonedata = jrest.CloneVolumeDescriptor{Name: nvd.Path(), Snapshot: nvd.VDS(), CreateParents: createParents(nvd), Properties: volumeProperties(md)}
+	if err = d.re.CreateClone(sctx, pool, vd.Path(), clonedata); err != nil {
+		l.Warnf("Unable to create volume %s from snapshot %s of volume %s, because of error %+v. Removing intermediate snapshot", nvd.Path(), nvd.VDS(), vd.Path(), err.Error())
 
-		d.deleteIntermediateSnapshot(ctx, pool, vd.VDS(), nvd.VDS())
+		cleanup()
 		return err
 	}
 
@@ -203,7 +253,7 @@ func (d *CSIDriver) cleanIntermediateSnapshots(ctx context.Context, pool string,
 				forceUnmount := true
 				snapdeldata := jrest.DeleteSnapshotDescriptor{ForceUnmount: &forceUnmount}
 
-				err = d.re.DeleteSnapshot(ctx, pool, vd.VDS(), snap.Name, snapdeldata)
+				err = d.re.DeleteSnapshot(ctx, pool, vd.Path(), snap.Name, snapdeldata)
 				if err != nil {
 					return nil, err
 				}
@@ -218,77 +268,182 @@ func (d *CSIDriver) cleanIntermediateSnapshots(ctx context.Context, pool string,
 	return out, nil
 }
 
-func (d *CSIDriver) deleteLUN(ctx context.Context, pool string, vd *VolumeDesc) (err jrest.RestError) {
+// isDNE checks if error indicates that requested resource does not exist
+func isDNE(err jrest.RestError) bool {
+	return err != nil && errors.Is(err, jrest.ErrResourceDNE)
+}
+
+// destroyLUN deletes volume, intermediate snapshots that prevent deletion get cleaned
+func (d *CSIDriver) destroyLUN(ctx context.Context, pool string, vd *VolumeDesc) (err jrest.RestError) {
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(logrus.Fields{
-		"func":    "deleteLUN",
+		"func":    "destroyLUN",
 		"section": "driver",
 	})
 
 	forceUmount := true
 	var deldata = jrest.DeleteVolumeDescriptor{ForceUmount: &forceUmount}
-	err = d.re.DeleteVolume(ctx, pool, vd.VDS(), deldata)
+	err = d.re.DeleteVolume(ctx, pool, vd.Path(), deldata)
 
 	switch jrest.ErrCode(err) {
 	case jrest.RestErrorResourceBusy, jrest.RestErrorResourceBusyVolumeHasSnapshots:
 		break
-	case jrest.RestErrorResourceDNE:
+	default:
+		return err
+	}
+	l.Debugf("Volume %s is busy, cleaning intermediate snapshots", vd.Name())
+
+	if _, gserr := d.cleanIntermediateSnapshots(ctx, pool, vd); gserr != nil {
+		l.Debugf("Unable to clean intermediate snapshots of volume %s, error %s", vd.Name(), gserr.Error())
+		return err
+	}
+
+	return d.re.DeleteVolume(ctx, pool, vd.Path(), deldata)
+}
+
+// hideLUN renames volume so that it is not visible to CSI any more
+func (d *CSIDriver) hideLUN(ctx context.Context, pool string, vd *VolumeDesc) (err jrest.RestError) {
+
+	l := jcom.LFC(ctx)
+	l = l.WithFields(logrus.Fields{
+		"func":    "hideLUN",
+		"section": "driver",
+	})
+
+	hvd := NewHiddenVolumeDesc(vd)
+	l.Debugf("Hiding volume %s as %s", vd.Path(), hvd.Path())
+
+	return d.re.RenameVolume(ctx, pool, vd.Path(), jrest.RenameVolumeDescriptor{Name: hvd.VDS()})
+}
+
+// releaseOrigin cleans up resources that deleted volume was derived from
+//
+// It deletes intermediate snapshot that volume was cloned from and
+// destroys origin volume if it is hidden and nothing else depends on it
+func (d *CSIDriver) releaseOrigin(ctx context.Context, pool string, vol *jrest.ResourceVolume) {
+
+	l := jcom.LFC(ctx)
+	l = l.WithFields(logrus.Fields{
+		"func":    "releaseOrigin",
+		"section": "driver",
+	})
+
+	ovds := vol.OriginVolume()
+	osds := vol.OriginSnapshot()
+
+	if len(ovds) == 0 || len(osds) == 0 {
+		return
+	}
+
+	if IsVDS(osds) {
+		forceUnmount := true
+		snapdeldata := jrest.DeleteSnapshotDescriptor{ForceUnmount: &forceUnmount}
+
+		if err := d.re.DeleteSnapshot(ctx, pool, ovds, osds, snapdeldata); err != nil && !isDNE(err) {
+			l.Warnf("Unable to delete intermediate snapshot %s of volume %s, error %s", osds, ovds, err.Error())
+			return
+		}
+	}
+
+	if ovd, err := NewVolumeDescFromPath(ovds); err == nil {
+		d.releaseHidden(ctx, pool, ovd)
+	}
+}
+
+// releaseHidden destroys hidden volume if the last resource that depended on it is gone,
+// volume stays hidden if there are still resources that depend on it
+func (d *CSIDriver) releaseHidden(ctx context.Context, pool string, vd *VolumeDesc) {
+
+	if !vd.IsHidden() {
+		return
+	}
+
+	l := jcom.LFC(ctx)
+	l = l.WithFields(logrus.Fields{
+		"func":    "releaseHidden",
+		"section": "driver",
+	})
+
+	l.Debugf("Last dependent resource of hidden volume %s might be gone, trying to delete it", vd.VDS())
+	if rErr := d.deleteLUN(ctx, pool, vd); rErr != nil {
+		l.Warnf("Unable to delete hidden volume %s, error %s", vd.Path(), rErr.Error())
+	}
+}
+
+// deleteLUN deletes volume or hides it if it still have dependent snapshots or clones
+//
+// Hidden volume gets deleted once the last resource that depends on it is deleted
+func (d *CSIDriver) deleteLUN(ctx context.Context, pool string, vd *VolumeDesc) (err jrest.RestError) {
+
+	l := jcom.LFC(ctx)
+	l = l.WithFields(logrus.Fields{
+		"func":    "deleteLUN",
+		"section": "driver",
+	})
+
+	vol, err := d.re.GetVolume(ctx, pool, vd.Path())
+
+	switch {
+	case err == nil:
+		break
+	case isDNE(err):
+		l.Debugf("Volume %s do not exists", vd.VDS())
 		return nil
+	default:
+		return err
+	}
+
+	err = d.destroyLUN(ctx, pool, vd)
+
+	switch jrest.ErrCode(err) {
 	case jrest.RestErrorOk:
+		d.releaseOrigin(ctx, pool, vol)
+		return nil
+	case jrest.RestErrorResourceDNE, jrest.RestErrorResourceDNEVolume:
 		return nil
+	case jrest.RestErrorResourceBusy, jrest.RestErrorResourceBusyVolumeHasSnapshots:
+		break
 	default:
 		l.Debugf("Unable to delete lun %s, error had happaned %+v", vd.Name(), err.Error())
 		return err
 	}
-	l.Debugf("Volume %s is busy, indentifying relaying resources", vd.Name())
 
-	if err.GetCode() == jrest.RestErrorResourceBusy {
-		snaps, gserr := d.cleanIntermediateSnapshots(ctx, pool, vd)
+	// Storage might report volume as busy for other reasons,
+	// volume is only hidden if there are resources that keep it from deletion
+	deps, dErr := d.dependents(ctx, pool, vd)
+	if dErr != nil {
+		l.Debugf("Unable to list dependent resources of volume %s, error %s", vd.Name(), dErr.Error())
+		return err
+	}
+	if len(deps) == 0 {
+		l.Warnf("Volume %s is busy yet it has no dependent resources", vd.Name())
+		return err
+	}
 
-		if gserr != nil {
-			switch gserr.GetCode() {
-			case jrest.RestErrorResourceDNE:
-				return gserr
-			default:
-				// TODO: think about providing better error information for cases
-				// when we are not able to provide proper list of dependent snapshots
-				return err
-			}
-		}
-		l.Debugf("Snapshots after cleaning intermediate one %+v", snaps)
-		// Looks like this volume is busy and we are not able to delete it
-
-		var dvols []string
-		var dsnaps []string
-		var ncsi []string
-		msg := fmt.Sprintf("Volume %s is dependent upon by", vd.Name())
-
-		for _, snap := range snaps {
-			if IsSDS(snap.Name) {
-				dsnaps = append(dsnaps, snap.Name)
-			} else if IsVDS(snap.Name) {
-				clones := snap.ClonesNames()
-				dvols = append(dvols, clones...)
-			} else {
-				msg += fmt.Sprintf(" not CSI relates snapshots: %s", strings.Join(dsnaps[:], ","))
-			}
-		}
+	if vd.IsHidden() {
+		l.Debugf("Hidden volume %s still have dependent resources %v", vd.VDS(), deps)
+		return nil
+	}
 
-		if len(dvols) > 0 {
-			msg += fmt.Sprintf(" volumes: %s", strings.Join(dvols[:], ","))
-		}
-		if len(dsnaps) > 0 {
-			msg += fmt.Sprintf(" snapshots: %s", strings.Join(dsnaps[:], ","))
-		}
-		if len(ncsi) > 0 {
-			msg += fmt.Sprintf(" not CSI relates snapshots: %s", strings.Join(ncsi[:], ","))
-		}
-		err = jrest.GetError(jrest.RestErrorResourceBusy, msg)
-		//fmt.Sprintf("%s %v %v", msg, dsnaps, dvols))
+	l.Debugf("Volume %s is busy, hiding it till dependent resources %v are deleted", vd.Name(), deps)
+
+	return d.hideLUN(ctx, pool, vd)
+}
+
+// dependents gives names of snapshots of the volume and clones made from them
+func (d *CSIDriver) dependents(ctx context.Context, pool string, vd *VolumeDesc) (deps []string, err jrest.RestError) {
+
+	snaps, _, err := d.ListVolumeSnapshots(ctx, pool, vd, 0, NewCSIListingToken())
+	if err != nil {
+		return nil, err
 	}
 
-	return err
+	for i := range snaps {
+		deps = append(deps, vd.Path()+"@"+snaps[i].Name)
+		deps = append(deps, snaps[i].ClonesNames()...)
+	}
+	return deps, nil
 }
 
 func (d *CSIDriver) DeleteVolume(ctx context.Context, pool string, vid *VolumeDesc) jrest.RestError {
@@ -367,16 +522,17 @@ func getResourcesList[RestResource any](ctx context.Context, maxret int, token C
 				return lres, nil, nil
 			}
 
+			// Token points to the last entry that was already given, listing continues after it
 			if len(token.BasedID()) == 0 {
 				lres = append(lres, (ent)...)
-			} else if token.BasedID() <= BasedID(ent[0]) {
+			} else if token.BasedID() < BasedID(ent[0]) {
 				lres = append(lres, (ent)...)
 				token.DropBasedID()
 			} else {
 				for i, e := range ent {
 					if BasedID(e) == token.BasedID() {
-						lres = append(lres, ent[i:]...)
-						token.BasedID()
+						lres = append(lres, ent[i+1:]...)
+						token.DropBasedID()
 						break
 					}
 				}
@@ -442,7 +598,7 @@ func (d *CSIDriver) ListVolumeSnapshots(ctx context.Context, pool string, vid *V
 
 	grf := func(ctx context.Context, token CSIListingToken) (lres []jrest.ResourceSnapshot, err jrest.RestError) {
 		l.Debugln("Getting Volume Snapshots entries")
-		entr, err := d.re.GetVolumeSnapshotsEntries(ctx, pool, vid.VDS(), token.Page(), token.DC())
+		entr, err := d.re.GetVolumeSnapshotsEntries(ctx, pool, vid.Path(), token.Page(), token.DC())
 
 		if err != nil {
 			return nil, err
@@ -463,12 +619,19 @@ func (d *CSIDriver) ListVolumeSnapshots(ctx context.Context, pool string, vid *V
 	}
 }
 
-func NewJovianDSSCSIDriver(cfg *jcom.RestEndpointCfg, l *logrus.Entry) (d *CSIDriver, err error) {
+// NewJovianDSSCSIDriver creates driver that manages volumes, snapshots and targets on given storage
+func NewJovianDSSCSIDriver(re jrest.StorageInterface, l *logrus.Entry) (d *CSIDriver, err error) {
+
+	if re == nil {
+		return nil, fmt.Errorf("storage is not provided")
+	}
 
-	var drvr CSIDriver
-	jrest.SetupEndpoint(&drvr.re, cfg, l)
+	d = &CSIDriver{
+		re: re,
+		l:  l.WithFields(logrus.Fields{"section": "driver"}),
+	}
 
-	return &drvr, nil
+	return d, nil
 }
 
 func (d *CSIDriver) GetVolume(ctx context.Context, pool string, vd *VolumeDesc) (out *jrest.ResourceVolume, err jrest.RestError) {
@@ -482,7 +645,7 @@ func (d *CSIDriver) GetVolume(ctx context.Context, pool string, vd *VolumeDesc)
 
 	l.Debugf("Get volume with id: %s", vd.VDS())
 
-	return d.re.GetVolume(ctx, pool, vd.VDS()) // v for Volume
+	return d.re.GetVolume(ctx, pool, vd.Path()) // v for Volume
 }
 
 func (d *CSIDriver) GetSnapshot(ctx context.Context, pool string, vd LunDesc, sd *SnapshotDesc) (out *jrest.ResourceSnapshot, err jrest.RestError) {
@@ -495,10 +658,16 @@ func (d *CSIDriver) GetSnapshot(ctx context.Context, pool string, vd LunDesc, sd
 
 	l.Debugf("Get snapshot %s of volume %s", sd.SDS(), vd.VDS())
 
-	return d.re.GetVolumeSnapshot(ctx, pool, vd.VDS(), sd.SDS())
+	out, err = d.re.GetVolumeSnapshot(ctx, pool, vd.Path(), sd.SDS())
+
+	// Source volume might be hidden after deletion
+	if isDNE(err) && !IsHiddenVDS(vd.VDS()) {
+		return d.re.GetVolumeSnapshot(ctx, pool, NewHiddenVolumeDesc(vd).Path(), sd.SDS())
+	}
+	return out, err
 }
 
-func (d *CSIDriver) CreateSnapshot(ctx context.Context, pool string, vd *VolumeDesc, sd *SnapshotDesc) jrest.RestError {
+func (d *CSIDriver) CreateSnapshot(ctx context.Context, pool string, vd *VolumeDesc, sd *SnapshotDesc, md Metadata) jrest.RestError {
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(logrus.Fields{
@@ -509,8 +678,11 @@ func (d *CSIDriver) CreateSnapshot(ctx context.Context, pool string, vd *VolumeD
 	l.Debugf("Create snapshot %s for volume %s", sd.SDS(), vd.VDS())
 
 	var snapdata = jrest.CreateSnapshotDescriptor{SnapshotName: sd.SDS()}
+	if up := md.UserProperties(); len(up) > 0 {
+		snapdata.Properties = &jrest.CreateSnapshotProperties{User: up}
+	}
 
-	return d.re.CreateSnapshot(ctx, pool, vd.VDS(), &snapdata)
+	return d.re.CreateSnapshot(ctx, pool, vd.Path(), &snapdata)
 }
 
 func (d *CSIDriver) DeleteSnapshot(ctx context.Context, pool string, ld LunDesc, sd *SnapshotDesc) jrest.RestError {
@@ -526,15 +698,34 @@ func (d *CSIDriver) DeleteSnapshot(ctx context.Context, pool string, ld LunDesc,
 	forceUmount := true
 	var deldata = jrest.DeleteSnapshotDescriptor{ForceUnmount: &forceUmount}
 
-	err := d.re.DeleteSnapshot(ctx, pool, ld.VDS(), sd.SDS(), deldata)
+	err := d.re.DeleteSnapshot(ctx, pool, ld.Path(), sd.SDS(), deldata)
+
+	// Source volume might be hidden after deletion
+	var hvd *VolumeDesc
+	if isDNE(err) && !IsHiddenVDS(ld.VDS()) {
+		hvd = NewHiddenVolumeDesc(ld)
+		if herr := d.re.DeleteSnapshot(ctx, pool, hvd.Path(), sd.SDS(), deldata); isDNE(herr) {
+			hvd = nil
+		} else {
+			ld = hvd
+			err = herr
+		}
+	}
+
+	if err == nil {
+		if hvd != nil {
+			d.releaseHidden(ctx, pool, hvd)
+		}
+		return nil
+	}
 
 	var dvols []string
 	var dsnaps []string
 	var ncsi []string
 	var msg string
 
-	if err.GetCode() == jrest.RestErrorResourceBusy || err.GetCode() == jrest.RestErrorResourceBusySnapshotHasClones {
-		if clones, rErr := d.re.GetVolumeSnapshotClones(ctx, pool, ld.VDS(), sd.SDS()); rErr != nil {
+	if errors.Is(err, jrest.ErrResourceBusy) {
+		if clones, rErr := d.re.GetVolumeSnapshotClones(ctx, pool, ld.Path(), sd.SDS()); rErr != nil {
 			return rErr
 		} else {
 			for _, clone := range clones {
@@ -556,7 +747,7 @@ func (d *CSIDriver) DeleteSnapshot(ctx context.Context, pool string, ld LunDesc,
 		var delclone = jrest.DeleteVolumeDescriptor{ForceUmount: &forceUmount}
 
 		for _, snapclone := range dsnaps {
-			if rErr := d.re.DeleteClone(ctx, pool, ld.VDS(), sd.SDS(), snapclone, delclone); rErr != nil {
+			if rErr := d.re.DeleteClone(ctx, pool, ld.Path(), sd.SDS(), snapclone, delclone); rErr != nil {
 				msg = fmt.Sprintf("Unable to delete snapshot %s with ID %s because it has volume associated with it %s that cant be deleted, please delete physical zvol first", sd.Name(), sd.CSIID(), snapclone)
 				return jrest.GetError(jrest.RestErrorResourceBusy, msg)
 			}
@@ -603,7 +794,7 @@ func (d *CSIDriver) PublishVolume(ctx context.Context, pool string, ld LunDesc,
 	})
 
 	// We want target name to be uniquee
-	tname := fmt.Sprintf("%x", sha256.Sum256([]byte(ld.VDS())))
+	tname := fmt.Sprintf("%x", sha256.Sum256([]byte(ld.Path())))
 	iqn := fmt.Sprintf("%s:%s", iqnPrefix, tname)
 
 	if len(tname) > 255 {
@@ -634,7 +825,7 @@ func (d *CSIDriver) PublishVolume(ctx context.Context, pool string, ld LunDesc,
 
 	var attachLun jrest.TargetLunDescriptor
 
-	attachLun.Name = ld.VDS()
+	attachLun.Name = ld.Path()
 	attachLun.Mode = &mode
 	var lunID = 0
 	attachLun.LUN = &lunID
@@ -660,19 +851,22 @@ func (d *CSIDriver) PublishVolume(ctx context.Context, pool string, ld LunDesc,
 	iContext["target"] = tname
 	iContext["lun"] = fmt.Sprintf("%d", lunID)
 
-	for i := 0; i < 3; i++ {
+	for i := 0; i < targetWaitTries; i++ {
 		target, rErr := d.re.GetTarget(ctx, pool, iqn)
 		switch jrest.ErrCode(rErr) {
 		case jrest.RestErrorOk:
 			if target.Active == true {
 				return &iContext, nil
 			}
-		case jrest.RestErrorResourceDNE:
-			// According to specification from
-			time.Sleep(time.Second)
-			continue
-		default:
-			continue
+		case jrest.RestErrorRequestCanceled, jrest.RestErrorDeadlineExceeded:
+			return nil, rErr
+		}
+
+		// Target is not ready yet
+		select {
+		case <-ctx.Done():
+			return nil, jrest.ContextError(ctx)
+		case <-time.After(targetWaitInterval):
 		}
 	}
 
@@ -694,7 +888,7 @@ func (d *CSIDriver) UnpublishVolume(ctx context.Context, pool string, prefix str
 		return rErr
 	}
 
-	rErr = d.re.DettachVolumeFromTarget(ctx, pool, *iqn, ld.VDS())
+	rErr = d.re.DettachVolumeFromTarget(ctx, pool, *iqn, ld.Path())
 
 	if rErr != nil {
 		code := rErr.GetCode()
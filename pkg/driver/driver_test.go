@@ -0,0 +1,143 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	jcom "joviandss-kubernetescsi/pkg/common"
+	jrest "joviandss-kubernetescsi/pkg/rest"
+	"joviandss-kubernetescsi/pkg/rest/fake"
+)
+
+const testPool = "Pool-0"
+
+func testLogger() *logrus.Entry {
+	l := logrus.New()
+	l.Out = io.Discard
+	return logrus.NewEntry(l)
+}
+
+// testDriver gives driver connected to fake storage
+func testDriver(t *testing.T) (*CSIDriver, *fake.Server, context.Context) {
+	t.Helper()
+
+	s := fake.NewServer(testPool)
+	t.Cleanup(s.Close)
+
+	cfg := s.EndpointCfg()
+	var re jrest.RestEndpoint
+	if err := jrest.SetupEndpoint(&re, &cfg, testLogger()); err != nil {
+		t.Fatalf("unable to setup endpoint: %s", err)
+	}
+	d, err := NewJovianDSSCSIDriver(&re, testLogger())
+	if err != nil {
+		t.Fatalf("unable to setup driver: %s", err)
+	}
+	return d, s, jcom.WithLogger(context.Background(), testLogger())
+}
+
+func testVolume(t *testing.T, d *CSIDriver, ctx context.Context, name string) *VolumeDesc {
+	t.Helper()
+
+	vd, err := NewVolumeDescFromName(name)
+	if err != nil {
+		t.Fatalf("unable to make volume descriptor: %s", err)
+	}
+	if rErr := d.CreateVolume(ctx, testPool, vd, 1<<30, Metadata{}); rErr != nil {
+		t.Fatalf("unable to create volume %s: %s", name, rErr)
+	}
+	return vd
+}
+
+func TestDeleteVolumeHidesVolumeWithSnapshots(t *testing.T) {
+	d, s, ctx := testDriver(t)
+
+	vd := testVolume(t, d, ctx, "vol")
+	sd, err := NewSnapshotDescFromName(vd, "snap")
+	if err != nil {
+		t.Fatalf("unable to make snapshot descriptor: %s", err)
+	}
+	if rErr := d.CreateSnapshot(ctx, testPool, vd, sd, Metadata{}); rErr != nil {
+		t.Fatalf("unable to create snapshot: %s", rErr)
+	}
+
+	if rErr := d.DeleteVolume(ctx, testPool, vd); rErr != nil {
+		t.Fatalf("unable to delete volume: %s", rErr)
+	}
+	if s.HasVolume(vd.Path()) {
+		t.Errorf("volume %s is still visible", vd.Path())
+	}
+	if hvd := NewHiddenVolumeDesc(vd); !s.HasVolume(hvd.Path()) {
+		t.Errorf("volume is not hidden as %s", hvd.Path())
+	}
+}
+
+func TestDeleteVolumeKeepsBusyVolumeWithoutDependents(t *testing.T) {
+	d, s, ctx := testDriver(t)
+
+	vd := testVolume(t, d, ctx, "vol")
+
+	// Storage claims volume is busy, while nothing depends on it
+	errno := 1000
+	s.InjectFault(fake.Fault{
+		Method: http.MethodDelete,
+		Path:   regexp.MustCompile(regexp.QuoteMeta(vd.VDS()) + `$`),
+		Error: &fake.Error{
+			Status: http.StatusInternalServerError,
+			Class:  fake.ClassZfsCmd,
+			Errno:  &errno,
+			Message: fmt.Sprintf("cannot destroy '%s/%s': volume has children\nuse '-r' to destroy the following datasets:\n%s/%s@ghost",
+				testPool, vd.Path(), testPool, vd.Path()),
+		},
+	})
+
+	rErr := d.DeleteVolume(ctx, testPool, vd)
+	if jrest.ErrCode(rErr) != jrest.RestErrorResourceBusyVolumeHasSnapshots {
+		t.Fatalf("got error %v, expected volume busy error to be returned", rErr)
+	}
+	if !s.HasVolume(vd.Path()) {
+		t.Errorf("volume %s without dependents was hidden", vd.Path())
+	}
+}
+
+func TestDeleteVolumeKeepsVolumeOnOutage(t *testing.T) {
+	d, s, ctx := testDriver(t)
+
+	vd := testVolume(t, d, ctx, "vol")
+
+	s.InjectFault(fake.Fault{
+		Method: http.MethodDelete,
+		Error:  &fake.Error{Status: http.StatusServiceUnavailable, Message: "Service unavailable."},
+	})
+
+	rErr := d.DeleteVolume(ctx, testPool, vd)
+	if jrest.ErrCode(rErr) != jrest.RestErrorServiceUnavailable {
+		t.Fatalf("got error %v, expected service unavailable", rErr)
+	}
+	if !s.HasVolume(vd.Path()) {
+		t.Errorf("volume %s was hidden because of storage outage", vd.Path())
+	}
+}
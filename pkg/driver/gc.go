@@ -0,0 +1,312 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+
+	jcom "joviandss-kubernetescsi/pkg/common"
+	jrest "joviandss-kubernetescsi/pkg/rest"
+)
+
+const (
+	defaultGCInterval    = 30 * time.Minute
+	defaultGCGracePeriod = time.Hour
+)
+
+const targetHashPattern = `^[0-9a-f]{64}$`
+
+var targetHashRegexp = regexp.MustCompile(targetHashPattern)
+
+// GarbageCollector periodically removes resources left behind by failed operations
+//
+// Those are intermediate snapshots that have no clones and targets that have no volumes attached.
+// Only resources that belong to the cluster are collected, since pool might be shared
+type GarbageCollector struct {
+	d         *CSIDriver
+	pool      string
+	iqnPrefix string
+	naming    *VolumeNaming
+	interval  time.Duration
+	grace     time.Duration
+	dryRun    bool
+	l         *logrus.Entry
+
+	// time when orphaned target was noticed first time
+	orphans map[string]time.Time
+}
+
+// NewGarbageCollector creates garbage collector for the given pool
+func NewGarbageCollector(d *CSIDriver, pool string, iqnPrefix string, naming *VolumeNaming, cfg *jcom.GCCfg, l *logrus.Entry) (gc *GarbageCollector, err error) {
+
+	gc = &GarbageCollector{
+		d:         d,
+		pool:      pool,
+		iqnPrefix: iqnPrefix,
+		naming:    naming,
+		interval:  defaultGCInterval,
+		grace:     defaultGCGracePeriod,
+		dryRun:    cfg.DryRun,
+		orphans:   make(map[string]time.Time),
+	}
+
+	gc.l = l.WithFields(logrus.Fields{
+		"section": "gc",
+		"dryrun":  cfg.DryRun,
+	})
+
+	if len(cfg.Interval) > 0 {
+		if gc.interval, err = time.ParseDuration(cfg.Interval); err != nil {
+			gc.l.Warnf("Uncorrect gc interval value: %s, Error %s", cfg.Interval, err)
+			return nil, err
+		}
+	}
+
+	if len(cfg.GracePeriod) > 0 {
+		if gc.grace, err = time.ParseDuration(cfg.GracePeriod); err != nil {
+			gc.l.Warnf("Uncorrect gc grace period value: %s, Error %s", cfg.GracePeriod, err)
+			return nil, err
+		}
+	}
+
+	if gc.interval <= 0 {
+		return nil, fmt.Errorf("gc interval have to be positive, got %s", gc.interval)
+	}
+
+	return gc, nil
+}
+
+// Run collects garbage every interval till context is canceled
+func (gc *GarbageCollector) Run(ctx context.Context) {
+
+	gc.l.Infof("Starting garbage collector with interval %s and grace period %s", gc.interval, gc.grace)
+
+	ticker := time.NewTicker(gc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			gc.l.Info("Stopping garbage collector")
+			return
+		case <-ticker.C:
+			gc.collectSafely(jcom.WithLogger(ctx, gc.l))
+		}
+	}
+}
+
+// collectSafely runs single pass of Collect, panic during the pass is logged
+// and collector proceeds with the next one
+func (gc *GarbageCollector) collectSafely(ctx context.Context) {
+	defer jcom.RecoverPanic(gc.l, "garbage collector")
+	gc.Collect(ctx)
+}
+
+// Collect makes single pass over pool resources and removes leftovers
+func (gc *GarbageCollector) Collect(ctx context.Context) {
+
+	l := jcom.LFC(ctx)
+	l = l.WithFields(logrus.Fields{
+		"func": "Collect",
+	})
+
+	l.Debug("Collecting garbage")
+
+	if err := gc.collectSnapshots(ctx, time.Now()); err != nil {
+		l.Warnf("Unable to collect intermediate snapshots, error %s", err.Error())
+	}
+
+	if err := gc.collectTargets(ctx, time.Now()); err != nil {
+		l.Warnf("Unable to collect orphaned targets, error %s", err.Error())
+	}
+}
+
+// collectSnapshots deletes intermediate snapshots that are older then grace period and have no clones,
+// hidden volumes are destroyed once their last snapshot is deleted
+func (gc *GarbageCollector) collectSnapshots(ctx context.Context, now time.Time) jrest.RestError {
+
+	l := jcom.LFC(ctx)
+	l = l.WithFields(logrus.Fields{
+		"func": "collectSnapshots",
+	})
+
+	snaps, _, err := gc.d.ListAllSnapshots(ctx, gc.pool, 0, NewCSIListingToken())
+	if err != nil {
+		return err
+	}
+
+	for _, s := range snaps {
+		if len(s.Name) == 0 || len(s.Volume) == 0 || !IsVDS(s.Name) {
+			continue
+		}
+		// Only volumes created by CSI are of interest
+		vd, verr := NewVolumeDescFromPath(s.Volume)
+		if verr != nil {
+			continue
+		}
+		// Intermediate snapshot is named after the clone it was made for
+		cvd, cerr := NewVolumeDescFromVDS(s.Name)
+		if cerr != nil || !gc.naming.Owns(cvd.Name(), s.Properties.UserProperties) {
+			continue
+		}
+		if now.Sub(s.Properties.Creation) < gc.grace {
+			continue
+		}
+
+		clones, cerr := gc.d.re.GetVolumeSnapshotClones(ctx, gc.pool, s.Volume, s.Name)
+		if cerr != nil {
+			l.Warnf("Unable to get clones of snapshot %s of volume %s, error %s", s.Name, s.Volume, cerr.Error())
+			continue
+		}
+		if len(clones) > 0 {
+			continue
+		}
+
+		if gc.dryRun {
+			l.Infof("Dry run: intermediate snapshot %s of volume %s created at %s would be deleted", s.Name, s.Volume, s.Properties.Creation)
+			continue
+		}
+
+		l.Infof("Deleting intermediate snapshot %s of volume %s created at %s", s.Name, s.Volume, s.Properties.Creation)
+
+		forceUnmount := true
+		snapdeldata := jrest.DeleteSnapshotDescriptor{ForceUnmount: &forceUnmount}
+
+		if derr := gc.d.re.DeleteSnapshot(ctx, gc.pool, s.Volume, s.Name, snapdeldata); derr != nil && !isDNE(derr) {
+			l.Warnf("Unable to delete intermediate snapshot %s of volume %s, error %s", s.Name, s.Volume, derr.Error())
+			continue
+		}
+
+		// Snapshot might have been the last thing that kept deleted volume
+		gc.d.releaseHidden(ctx, gc.pool, vd)
+	}
+	return nil
+}
+
+// collectTargets deletes CSI targets that have no volumes attached for longer then grace period
+func (gc *GarbageCollector) collectTargets(ctx context.Context, now time.Time) jrest.RestError {
+
+	l := jcom.LFC(ctx)
+	l = l.WithFields(logrus.Fields{
+		"func": "collectTargets",
+	})
+
+	targets, err := gc.d.re.ListTargets(ctx, gc.pool)
+	if err != nil {
+		return err
+	}
+
+	// Target name is a hash of volume path, so it tells nothing about the owner
+	var owned map[string]bool
+	if len(gc.naming.Cluster()) > 0 {
+		if owned, err = gc.ownedTargets(ctx); err != nil {
+			return err
+		}
+	}
+
+	orphans := make(map[string]time.Time)
+
+	for _, t := range targets {
+		if !gc.isCSITarget(t.Name) {
+			continue
+		}
+		if owned != nil && !owned[t.Name] {
+			continue
+		}
+
+		luns, lerr := gc.d.re.GetTargetLuns(ctx, gc.pool, t.Name)
+		if lerr != nil {
+			l.Warnf("Unable to get luns of target %s, error %s", t.Name, lerr.Error())
+			continue
+		}
+		if len(luns) > 0 {
+			continue
+		}
+
+		seen, ok := gc.orphans[t.Name]
+		if !ok {
+			l.Debugf("Target %s have no luns attached", t.Name)
+			seen = now
+		}
+
+		if now.Sub(seen) < gc.grace {
+			orphans[t.Name] = seen
+			continue
+		}
+
+		if gc.dryRun {
+			l.Infof("Dry run: target %s without luns since %s would be deleted", t.Name, seen)
+			orphans[t.Name] = seen
+			continue
+		}
+
+		l.Infof("Deleting target %s without luns since %s", t.Name, seen)
+
+		if derr := gc.d.re.DeleteTarget(ctx, gc.pool, t.Name); derr != nil && !isDNE(derr) {
+			l.Warnf("Unable to delete target %s, error %s", t.Name, derr.Error())
+			orphans[t.Name] = seen
+		}
+	}
+
+	gc.orphans = orphans
+	return nil
+}
+
+// ownedTargets gives names of targets that volumes of the cluster are published with
+//
+// Targets of volumes that are already gone can not be attributed to the cluster and are left in place
+func (gc *GarbageCollector) ownedTargets(ctx context.Context) (map[string]bool, jrest.RestError) {
+
+	vols, _, err := gc.d.ListAllVolumes(ctx, gc.pool, 0, NewCSIListingToken())
+	if err != nil {
+		return nil, err
+	}
+
+	owned := make(map[string]bool)
+	for _, v := range vols {
+		vd, verr := NewVolumeDescFromPath(v.Path())
+		if verr != nil || !gc.naming.Owns(vd.Name(), v.UserProperties) {
+			continue
+		}
+		// Hidden volume was published under its original path
+		if vd.IsHidden() {
+			if vd, verr = NewVolumeDescFromCSIID(vd.CSIID()); verr != nil {
+				continue
+			}
+		}
+		if iqn, rErr := TargetIQN(gc.iqnPrefix, vd); rErr == nil {
+			owned[*iqn] = true
+		}
+	}
+	return owned, nil
+}
+
+// isCSITarget checks if target name was produced by TargetIQN
+func (gc *GarbageCollector) isCSITarget(tname string) bool {
+	prefix := gc.iqnPrefix + ":"
+
+	if len(tname) <= len(prefix) || tname[:len(prefix)] != prefix {
+		return false
+	}
+	return targetHashRegexp.MatchString(tname[len(prefix):])
+}
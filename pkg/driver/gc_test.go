@@ -0,0 +1,156 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	jcom "joviandss-kubernetescsi/pkg/common"
+	jrest "joviandss-kubernetescsi/pkg/rest"
+)
+
+func testNaming(t *testing.T, cluster string) *VolumeNaming {
+	t.Helper()
+
+	vn, err := NewVolumeNaming(&jcom.NamingCfg{Cluster: cluster})
+	if err != nil {
+		t.Fatalf("unable to make naming for cluster %q: %s", cluster, err)
+	}
+	return vn
+}
+
+// clusterVolume creates volume the way controller of the cluster does
+func clusterVolume(t *testing.T, d *CSIDriver, ctx context.Context, vn *VolumeNaming, name string) *VolumeDesc {
+	t.Helper()
+
+	md := vn.Metadata(name, nil)
+	vd, err := NewVolumeDescFromName(vn.VolumeName(md))
+	if err != nil {
+		t.Fatalf("unable to make volume descriptor: %s", err)
+	}
+	if rErr := d.CreateVolume(ctx, testPool, vd, 1<<30, md); rErr != nil {
+		t.Fatalf("unable to create volume %s: %s", name, rErr)
+	}
+	return vd
+}
+
+func TestCollectSnapshotsReleasesHiddenVolume(t *testing.T) {
+	d, s, ctx := testDriver(t)
+
+	vd := testVolume(t, d, ctx, "vol")
+	keep := testVolume(t, d, ctx, "keep")
+
+	// Intermediate snapshots are named after volumes they were made for
+	for _, v := range []*VolumeDesc{vd, keep} {
+		if rErr := d.re.CreateSnapshot(ctx, testPool, v.Path(), &jrest.CreateSnapshotDescriptor{SnapshotName: "vp_clone"}); rErr != nil {
+			t.Fatalf("unable to create intermediate snapshot: %s", rErr)
+		}
+	}
+	if rErr := d.hideLUN(ctx, testPool, vd); rErr != nil {
+		t.Fatalf("unable to hide volume: %s", rErr)
+	}
+	hvd := NewHiddenVolumeDesc(vd)
+
+	gc, err := NewGarbageCollector(d, testPool, jcom.DefaultIqn, testNaming(t, ""), &jcom.GCCfg{GracePeriod: "1m"}, testLogger())
+	if err != nil {
+		t.Fatalf("unable to create garbage collector: %s", err)
+	}
+	if rErr := gc.collectSnapshots(ctx, time.Now().Add(time.Hour)); rErr != nil {
+		t.Fatalf("unable to collect snapshots: %s", rErr)
+	}
+
+	if s.HasSnapshot(hvd.Path(), "vp_clone") {
+		t.Errorf("intermediate snapshot of hidden volume is not deleted")
+	}
+	if s.HasVolume(hvd.Path()) {
+		t.Errorf("hidden volume %s is not destroyed after its last snapshot is gone", hvd.Path())
+	}
+	if s.HasSnapshot(keep.Path(), "vp_clone") {
+		t.Errorf("intermediate snapshot of volume %s is not deleted", keep.Path())
+	}
+	if !s.HasVolume(keep.Path()) {
+		t.Errorf("visible volume %s is destroyed", keep.Path())
+	}
+}
+
+func TestCollectorKeepsResourcesOfOtherCluster(t *testing.T) {
+	d, s, ctx := testDriver(t)
+
+	type resources struct {
+		vd     *VolumeDesc
+		snap   string
+		target string
+	}
+	clusters := map[string]*resources{}
+	for _, c := range []string{"a", "b"} {
+		vn := testNaming(t, c)
+		r := &resources{vd: clusterVolume(t, d, ctx, vn, "vol")}
+
+		// Intermediate snapshot is named after the clone, that is named by the cluster template
+		clone, err := NewVolumeDescFromName(vn.VolumeName(vn.Metadata("clone", nil)))
+		if err != nil {
+			t.Fatalf("unable to make clone descriptor: %s", err)
+		}
+		r.snap = clone.VDS()
+		if rErr := d.re.CreateSnapshot(ctx, testPool, r.vd.Path(), &jrest.CreateSnapshotDescriptor{SnapshotName: r.snap}); rErr != nil {
+			t.Fatalf("unable to create intermediate snapshot: %s", rErr)
+		}
+
+		// Target is left without luns
+		iqn, rErr := TargetIQN(jcom.DefaultIqn, r.vd)
+		if rErr != nil {
+			t.Fatalf("unable to make target name: %s", rErr)
+		}
+		r.target = *iqn
+		if rErr = d.re.CreateTarget(ctx, testPool, &jrest.CreateTargetDescriptor{Name: r.target}); rErr != nil {
+			t.Fatalf("unable to create target: %s", rErr)
+		}
+		clusters[c] = r
+	}
+
+	gc, err := NewGarbageCollector(d, testPool, jcom.DefaultIqn, testNaming(t, "a"), &jcom.GCCfg{GracePeriod: "1m"}, testLogger())
+	if err != nil {
+		t.Fatalf("unable to create garbage collector: %s", err)
+	}
+	now := time.Now().Add(time.Hour)
+	if rErr := gc.collectSnapshots(ctx, now); rErr != nil {
+		t.Fatalf("unable to collect snapshots: %s", rErr)
+	}
+	// Target is collected once it stays orphaned for grace period
+	for _, tm := range []time.Time{now, now.Add(time.Hour)} {
+		if rErr := gc.collectTargets(ctx, tm); rErr != nil {
+			t.Fatalf("unable to collect targets: %s", rErr)
+		}
+	}
+
+	own, other := clusters["a"], clusters["b"]
+	if s.HasSnapshot(own.vd.Path(), own.snap) {
+		t.Errorf("intermediate snapshot %s of own cluster is not deleted", own.snap)
+	}
+	if s.HasTarget(own.target) {
+		t.Errorf("orphaned target %s of own cluster is not deleted", own.target)
+	}
+	if !s.HasSnapshot(other.vd.Path(), other.snap) {
+		t.Errorf("intermediate snapshot %s of other cluster is deleted", other.snap)
+	}
+	if !s.HasTarget(other.target) {
+		t.Errorf("orphaned target %s of other cluster is deleted", other.target)
+	}
+}
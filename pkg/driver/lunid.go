@@ -20,6 +20,7 @@ type DataInstanceDesc interface {
 type LunDesc interface {
 	Name() string
 	VDS() string
+	Path() string
 	CSIID() string
 }
 
@@ -31,10 +32,21 @@ type LunDesc interface {
 
 const MaxVolumeNameLength int = 248
 
+// hiddenVDSPrefix marks volumes that were deleted by CSI yet still kept because of dependent resources
+const hiddenVDSPrefix = "vh_"
+
 const allowedSymbolsPattern = `^[-\w]+$`
 
 var allowedSymbolsRegexp = regexp.MustCompile(allowedSymbolsPattern)
 
+// datasetComponentPattern matches single dataset name, names that consist only of dots like . and ..
+// are not allowed since they would change path of the REST request
+const datasetComponentPattern = `[-\w.]*[-\w][-\w.]*`
+
+const datasetPattern = `^` + datasetComponentPattern + `(/` + datasetComponentPattern + `)*$`
+
+var datasetRegexp = regexp.MustCompile(datasetPattern)
+
 func nameToID(name string) string {
 
 	// Replace each non-allowed symbol with its hexadecimal representation
@@ -47,10 +59,14 @@ func nameToID(name string) string {
 	return transformedString
 }
 
+// VolumeDesc identifies volume on storage and in kubernetes
+//
+// Zero value is not a valid descriptor, descriptors have to be created with constructors that check input
 type VolumeDesc struct {
 	name     string
 	vds      string
 	idFormat string
+	parent   string // datasets that volume is placed in, relative to pool
 }
 
 func NewVolumeDescFromName(name string) (*VolumeDesc, error) {
@@ -101,7 +117,31 @@ func NewVolumeDescFromName(name string) (*VolumeDesc, error) {
 // }
 
 func IsVDS(vds string) bool {
-	return vds[0] == 'v'
+	return strings.HasPrefix(vds, "v")
+}
+
+// IsHiddenVDS checks if volume descriptor string belongs to volume that was hidden
+// because it still have dependent snapshots or clones
+func IsHiddenVDS(vds string) bool {
+	return strings.HasPrefix(vds, hiddenVDSPrefix)
+}
+
+// NewHiddenVolumeDesc provides descriptor of the hidden counterpart of the volume
+//
+// Hidden volume keeps original vds in its name, so its CSIID stays the same
+func NewHiddenVolumeDesc(ld LunDesc) *VolumeDesc {
+	if IsHiddenVDS(ld.VDS()) {
+		if vd, err := NewVolumeDescFromPath(ld.Path()); err == nil {
+			return vd
+		}
+	}
+
+	return &VolumeDesc{
+		name:     ld.Name(),
+		vds:      hiddenVDSPrefix + ld.VDS(),
+		idFormat: "vh",
+		parent:   strings.TrimSuffix(strings.TrimSuffix(ld.Path(), ld.VDS()), "/"),
+	}
 }
 
 func NewVolumeDescFromVDS(vds string) (*VolumeDesc, error) {
@@ -137,6 +177,17 @@ func NewVolumeDescFromVDS(vds string) (*VolumeDesc, error) {
 	case "vs":
 		vd.name = ""
 		vd.idFormat = "vs"
+	// Hidden volume, that is original vds prefixed with vh
+	case "vh":
+		ovd, err := NewVolumeDescFromVDS(strings.Join(parts[1:], "_"))
+		if err != nil {
+			return nil, err
+		}
+		if IsHiddenVDS(ovd.VDS()) {
+			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Volume descriptor is hidden more then once %s", vds))
+		}
+		vd.name = ovd.name
+		vd.idFormat = "vh"
 	default:
 		return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("Unable to identify type of volume naming %s", vds))
 	}
@@ -144,8 +195,37 @@ func NewVolumeDescFromVDS(vds string) (*VolumeDesc, error) {
 	return &vd, nil
 }
 
+// NewVolumeDescFromPath parses volume path relative to pool
+//
+// Path is a vds that might be preceded by parent datasets, like parent/namespace/vds
+func NewVolumeDescFromPath(path string) (*VolumeDesc, error) {
+
+	i := strings.LastIndex(path, "/")
+
+	vd, err := NewVolumeDescFromVDS(path[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	if i >= 0 {
+		if err = vd.SetParent(path[:i]); err != nil {
+			return nil, err
+		}
+	}
+	return vd, nil
+}
+
+// NewVolumeDescFromCSIID parses volume id given to kubernetes, that is path of the volume
 func NewVolumeDescFromCSIID(csiid string) (*VolumeDesc, error) {
-	return NewVolumeDescFromVDS(csiid)
+	return NewVolumeDescFromPath(csiid)
+}
+
+// SetParent places volume in parent datasets, empty parent stands for pool root
+func (vid *VolumeDesc) SetParent(parent string) error {
+	if len(parent) > 0 && !datasetRegexp.MatchString(parent) {
+		return status.Error(codes.InvalidArgument, fmt.Sprintf("Parent dataset have bad format %s", parent))
+	}
+	vid.parent = parent
+	return nil
 }
 
 func (vid *VolumeDesc) Name() string {
@@ -156,18 +236,33 @@ func (vid *VolumeDesc) Name() string {
 	return vid.name
 }
 
+// VDS gives volume descriptor string, constructors reject input that would leave it empty
 func (vid *VolumeDesc) VDS() string {
-
-	if len(vid.vds) == 0 {
-		panic(fmt.Sprintf("Unable to identify volume sid %+v", vid))
-	}
 	return vid.vds
 }
 
 func (vid *VolumeDesc) CSIID() string {
 
-	if len(vid.vds) == 0 {
-		panic(fmt.Sprintf("Unable to identify volume sid and give proper CSIID %+v", vid))
+	vds := vid.vds
+	// Hidden volume is still known to kubernetes by its original id
+	if vid.idFormat == "vh" {
+		vds = strings.TrimPrefix(vid.vds, hiddenVDSPrefix)
 	}
-	return vid.vds
+	if len(vid.parent) > 0 {
+		return vid.parent + "/" + vds
+	}
+	return vds
+}
+
+// Path gives volume path relative to pool, that is how volume is addressed on storage
+func (vid *VolumeDesc) Path() string {
+	if len(vid.parent) > 0 {
+		return vid.parent + "/" + vid.VDS()
+	}
+	return vid.VDS()
+}
+
+// IsHidden indicates that volume was hidden because of dependent resources
+func (vid *VolumeDesc) IsHidden() bool {
+	return vid.idFormat == "vh"
 }
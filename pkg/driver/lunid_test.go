@@ -0,0 +1,64 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package driver
+
+import (
+	"testing"
+
+	jcom "joviandss-kubernetescsi/pkg/common"
+)
+
+func TestVolumeDescFromCSIID(t *testing.T) {
+	cases := []struct {
+		csiid string
+		valid bool
+	}{
+		{"vp_vol", true},
+		{"parent/vp_vol", true},
+		{"parent/ns.1/vp_vol", true},
+		{".hidden/vp_vol", true},
+		{"parent..old/vp_vol", true},
+		{"./vp_vol", false},
+		{"../vp_vol", false},
+		{"parent/../vp_vol", false},
+		{"parent/./vp_vol", false},
+		{"parent/.../vp_vol", false},
+		{"parent//vp_vol", false},
+		{"parent/%2e%2e/vp_vol", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.csiid, func(t *testing.T) {
+			vd, err := NewVolumeDescFromCSIID(c.csiid)
+			if c.valid && err != nil {
+				t.Errorf("volume id %s is rejected: %s", c.csiid, err)
+			}
+			if !c.valid && err == nil {
+				t.Errorf("volume id %s is accepted as volume %s", c.csiid, vd.Path())
+			}
+		})
+	}
+}
+
+func TestNamingRejectsRelativeParent(t *testing.T) {
+	for _, parent := range []string{".", "..", "csi/..", "../csi"} {
+		if _, err := NewVolumeNaming(&jcom.NamingCfg{Parent: parent}); err == nil {
+			t.Errorf("parent dataset %s is accepted", parent)
+		}
+	}
+}
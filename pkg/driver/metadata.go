@@ -0,0 +1,112 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package driver
+
+import (
+	"sort"
+	"strings"
+)
+
+// ZFS user properties have to be in form module:property
+const userPropertyPrefix = "joviandss-csi:"
+
+// MetadataName is a key of original CSI name of volume or snapshot
+const MetadataName = "csi.storage.k8s.io/name"
+
+// MetadataCluster is a key of id of the cluster that created volume or snapshot
+const MetadataCluster = "joviandss.open-e.com/cluster"
+
+// Parameters that external-provisioner and external-snapshotter provide
+// when running with --extra-create-metadata and properties they are stored in
+var metadataProperties = map[string]string{
+	MetadataName:                                    "name",
+	MetadataCluster:                                 "cluster",
+	"csi.storage.k8s.io/pvc/name":                   "pvc_name",
+	"csi.storage.k8s.io/pvc/namespace":              "pvc_namespace",
+	"csi.storage.k8s.io/pv/name":                    "pv_name",
+	"csi.storage.k8s.io/volumesnapshot/name":        "volumesnapshot_name",
+	"csi.storage.k8s.io/volumesnapshot/namespace":   "volumesnapshot_namespace",
+	"csi.storage.k8s.io/volumesnapshotcontent/name": "volumesnapshotcontent_name",
+}
+
+// Metadata keeps original CSI name and kubernetes metadata of volume or snapshot
+//
+// Keys are the same as names of CSI parameters, original name is kept under MetadataName
+type Metadata map[string]string
+
+// NewMetadata picks metadata from parameters of CSI request
+func NewMetadata(name string, params map[string]string) Metadata {
+	md := make(Metadata)
+
+	if len(name) > 0 {
+		md[MetadataName] = name
+	}
+	for k, v := range params {
+		if _, ok := metadataProperties[k]; ok && k != MetadataName && k != MetadataCluster && len(v) > 0 {
+			md[k] = v
+		}
+	}
+	return md
+}
+
+// NewMetadataFromUserProperties restores metadata from ZFS user properties of volume or snapshot
+func NewMetadataFromUserProperties(up map[string]string) Metadata {
+	md := make(Metadata)
+
+	for k, prop := range metadataProperties {
+		if v, ok := up[userPropertyPrefix+prop]; ok && len(v) > 0 {
+			md[k] = v
+		}
+	}
+	return md
+}
+
+// UserProperties converts metadata to ZFS user properties
+func (md Metadata) UserProperties() map[string]string {
+	if len(md) == 0 {
+		return nil
+	}
+
+	up := make(map[string]string)
+	for k, v := range md {
+		if prop, ok := metadataProperties[k]; ok {
+			up[userPropertyPrefix+prop] = v
+		}
+	}
+	return up
+}
+
+// Name returns original CSI name
+func (md Metadata) Name() string {
+	return md[MetadataName]
+}
+
+// String gives metadata in form of key=value pairs sorted by key
+func (md Metadata) String() string {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + md[k]
+	}
+	return strings.Join(pairs, " ")
+}
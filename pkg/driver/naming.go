@@ -0,0 +1,188 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	jcom "joviandss-kubernetescsi/pkg/common"
+)
+
+// Placeholders that can be used in naming template
+const (
+	templateCluster   = "{{cluster}}"
+	templateName      = "{{name}}"
+	templateNamespace = "{{namespace}}"
+	templatePVC       = "{{pvc}}"
+	templatePV        = "{{pv}}"
+)
+
+const (
+	defaultTemplate        = templateName
+	defaultClusterTemplate = templateCluster + "-" + templateName
+)
+
+const templatePlaceholderPattern = `{{[^{}]*}}`
+
+var templatePlaceholderRegexp = regexp.MustCompile(templatePlaceholderPattern)
+
+const clusterPattern = `^[-\w]+$`
+
+var clusterRegexp = regexp.MustCompile(clusterPattern)
+
+// VolumeNaming builds names of new volumes according to template
+// and identifies resources that belong to the cluster
+type VolumeNaming struct {
+	cluster  string
+	template string
+	parent   string
+
+	// part of the name that precedes all placeholders except cluster one
+	prefix string
+}
+
+// NewVolumeNaming creates naming for the cluster
+//
+// Default template is {{name}} or {{cluster}}-{{name}} if cluster is set
+func NewVolumeNaming(cfg *jcom.NamingCfg) (vn *VolumeNaming, err error) {
+
+	vn = &VolumeNaming{
+		cluster:  cfg.Cluster,
+		template: cfg.Template,
+		parent:   strings.Trim(cfg.Parent, "/"),
+	}
+
+	if len(vn.parent) > 0 && !datasetRegexp.MatchString(vn.parent) {
+		return nil, fmt.Errorf("parent dataset %s have bad format", cfg.Parent)
+	}
+
+	if len(vn.cluster) > 0 && !clusterRegexp.MatchString(vn.cluster) {
+		return nil, fmt.Errorf("cluster %s contains symbols other then latin letters, digits, '-' and '_'", vn.cluster)
+	}
+
+	if len(vn.template) == 0 {
+		if len(vn.cluster) > 0 {
+			vn.template = defaultClusterTemplate
+		} else {
+			vn.template = defaultTemplate
+		}
+	}
+
+	for _, ph := range templatePlaceholderRegexp.FindAllString(vn.template, -1) {
+		switch ph {
+		case templateName, templateNamespace, templatePVC, templatePV:
+		case templateCluster:
+			if len(vn.cluster) == 0 {
+				return nil, fmt.Errorf("naming template %s uses %s, but cluster is not set", vn.template, templateCluster)
+			}
+		default:
+			return nil, fmt.Errorf("naming template %s contains unknown placeholder %s", vn.template, ph)
+		}
+	}
+
+	if len(vn.cluster) > 0 {
+		t := strings.ReplaceAll(vn.template, templateCluster, vn.cluster)
+		vn.prefix = t
+		if loc := templatePlaceholderRegexp.FindStringIndex(t); loc != nil {
+			vn.prefix = t[:loc[0]]
+		}
+		// Prefix that does not contain cluster id tells nothing about the owner
+		if !strings.Contains(vn.prefix, vn.cluster) {
+			vn.prefix = ""
+		}
+	}
+
+	return vn, nil
+}
+
+// Cluster returns cluster id, empty if cluster is not set
+func (vn *VolumeNaming) Cluster() string {
+	return vn.cluster
+}
+
+// Metadata picks metadata from parameters of CSI request and marks it with cluster id
+func (vn *VolumeNaming) Metadata(name string, params map[string]string) Metadata {
+	md := NewMetadata(name, params)
+	if len(vn.cluster) > 0 {
+		md[MetadataCluster] = vn.cluster
+	}
+	return md
+}
+
+// VolumeName gives name of the new volume from which VDS is made
+//
+// If metadata required by template is missing, falls back to the default template
+func (vn *VolumeNaming) VolumeName(md Metadata) string {
+
+	values := map[string]string{
+		templateCluster:   vn.cluster,
+		templateName:      md.Name(),
+		templateNamespace: md["csi.storage.k8s.io/pvc/namespace"],
+		templatePVC:       md["csi.storage.k8s.io/pvc/name"],
+		templatePV:        md["csi.storage.k8s.io/pv/name"],
+	}
+
+	template := vn.template
+	for _, ph := range templatePlaceholderRegexp.FindAllString(template, -1) {
+		if len(values[ph]) == 0 {
+			if len(vn.cluster) > 0 {
+				template = defaultClusterTemplate
+			} else {
+				template = defaultTemplate
+			}
+			break
+		}
+	}
+
+	return templatePlaceholderRegexp.ReplaceAllStringFunc(template, func(ph string) string {
+		return values[ph]
+	})
+}
+
+// VolumeParent gives datasets that new volume have to be placed in
+//
+// That is parent/namespace if parent is set and namespace is known,
+// parent if namespace is not known and empty string for pool root
+func (vn *VolumeNaming) VolumeParent(md Metadata) string {
+	if len(vn.parent) == 0 {
+		return ""
+	}
+	if ns := md["csi.storage.k8s.io/pvc/namespace"]; len(ns) > 0 && datasetRegexp.MatchString(ns) {
+		return vn.parent + "/" + ns
+	}
+	return vn.parent
+}
+
+// Owns checks if volume or snapshot belongs to the cluster
+//
+// Resource belongs to the cluster if it is marked with cluster id
+// or if its name starts with the prefix that template gives.
+// If cluster is not set every resource is considered to be owned
+func (vn *VolumeNaming) Owns(name string, up map[string]string) bool {
+	if len(vn.cluster) == 0 {
+		return true
+	}
+
+	if c, ok := NewMetadataFromUserProperties(up)[MetadataCluster]; ok {
+		return c == vn.cluster
+	}
+
+	return len(vn.prefix) > 0 && strings.HasPrefix(name, vn.prefix)
+}
@@ -13,6 +13,9 @@ import (
 	//jrest "joviandss-kubernetescsi/pkg/rest"
 )
 
+// SnapshotDesc identifies snapshot on storage and in kubernetes
+//
+// Zero value is not a valid descriptor, descriptors have to be created with constructors that check input
 type SnapshotDesc struct {
 	ld       LunDesc // volume that this snapshot is made from
 	name     string  // name given by user
@@ -25,14 +28,21 @@ type SnapshotDesc struct {
 }
 
 func IsSDS(vds string) bool {
-	return vds[0] == 's'
+	return strings.HasPrefix(vds, "s")
 }
 
-func NewSnapshotDescFromName(lid LunDesc, name string) *SnapshotDesc {
+func NewSnapshotDescFromName(lid LunDesc, name string) (*SnapshotDesc, error) {
 
 	// Get universal volume ID
 	var sd SnapshotDesc
 
+	if lid == nil {
+		return nil, status.Error(codes.InvalidArgument, "Source volume of snapshot is not identified")
+	}
+	if len(name) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "Name missing in request")
+	}
+
 	sd.ld = lid
 	sd.name = name
 
@@ -58,8 +68,8 @@ func NewSnapshotDescFromName(lid LunDesc, name string) *SnapshotDesc {
 
 	sd.csiID = fmt.Sprintf("%s_%s",
 		sd.sds,
-		base64.StdEncoding.EncodeToString([]byte(sd.ld.VDS())))
-	return &sd
+		base64.StdEncoding.EncodeToString([]byte(sd.ld.CSIID())))
+	return &sd, nil
 }
 
 // parseSDS take sds string as
@@ -104,6 +114,9 @@ func (sd *SnapshotDesc) parseSDS(sds string) error {
 func NewSnapshotDescFromSDS(ld LunDesc, sds string) (*SnapshotDesc, error) {
 	var sd SnapshotDesc
 
+	if ld == nil {
+		return nil, status.Error(codes.InvalidArgument, "Source volume of snapshot is not identified")
+	}
 	sd.ld = ld
 
 	if err := sd.parseSDS(sds); err != nil {
@@ -112,7 +125,7 @@ func NewSnapshotDescFromSDS(ld LunDesc, sds string) (*SnapshotDesc, error) {
 
 	sd.csiID = fmt.Sprintf("%s_%s",
 		sd.sds,
-		base64.StdEncoding.EncodeToString([]byte(sd.ld.VDS())))
+		base64.StdEncoding.EncodeToString([]byte(sd.ld.CSIID())))
 
 	return &sd, nil
 }
@@ -122,8 +135,6 @@ func NewSnapshotDescFromSDS(ld LunDesc, sds string) (*SnapshotDesc, error) {
 func NewSnapshotDescFromCSIID(csiid string) (*SnapshotDesc, error) {
 	var sd SnapshotDesc
 
-	sd.csiID = csiid
-
 	csiidl := strings.Split(csiid, "_")
 	if len(csiidl) <= 2 {
 		return nil, status.Errorf(codes.InvalidArgument, "Snapshot ID %s have bad format", csiid)
@@ -133,14 +144,22 @@ func NewSnapshotDescFromCSIID(csiid string) (*SnapshotDesc, error) {
 	if vds, err := base64.StdEncoding.DecodeString(csiidl[len(csiidl)-1:][0]); err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "Unable to decode volume section of snapshot ID %s have bad format, %s", csiid, err.Error())
 	} else {
-		if sd.ld, err = NewVolumeDescFromVDS(string(vds)); err != nil {
+		if sd.ld, err = NewVolumeDescFromCSIID(string(vds)); err != nil {
 			return nil, status.Errorf(codes.InvalidArgument, "Volume section of snapshot ID %s have bad format, %s", csiid, err.Error())
 		}
 	}
 
 	sd.sds = strings.Join(csiidl[:len(csiidl)-1], "_")
 
-	sd.parseSDS(sd.sds)
+	if err := sd.parseSDS(sd.sds); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Snapshot section of snapshot ID %s have bad format, %s", csiid, err.Error())
+	}
+
+	// Snapshot might be addressed by id of other form, like one that refers hidden volume,
+	// descriptor gives the same id as the one made from name
+	sd.csiID = fmt.Sprintf("%s_%s",
+		sd.sds,
+		base64.StdEncoding.EncodeToString([]byte(sd.ld.CSIID())))
 	return &sd, nil
 }
 
@@ -148,30 +167,33 @@ func (ps *SnapshotDesc) String() string {
 	return ps.CSIID()
 }
 
+// Name gives name of the snapshot, snapshots named by hash do not keep original name
+// so their sds is given instead
 func (sd *SnapshotDesc) Name() string {
 
 	if len(sd.name) == 0 {
-		panic(fmt.Sprintf("Unable to identify snapshot name %+v", sd))
+		return sd.sds
 	}
 	return sd.name
 }
 
+// SDS gives snapshot descriptor string, constructors reject input that would leave it empty
 func (sd *SnapshotDesc) SDS() string {
-
-	if len(sd.sds) == 0 {
-		panic(fmt.Sprintf("Unable to identify snapshot descriptor string %+v", sd))
-	}
 	return sd.sds
 }
 
+// CSIID gives snapshot id known to kubernetes, constructors reject input that would leave it empty
 func (sd *SnapshotDesc) CSIID() string {
-
-	if len(sd.csiID) == 0 {
-		panic(fmt.Sprintf("Unable to identify snapshot csi id %+v", sd))
-	}
 	return sd.csiID
 }
 
 func (sd *SnapshotDesc) GetVD() LunDesc {
 	return sd.ld
 }
+
+// hidden provides descriptor of the same snapshot that is stored on hidden volume
+func (sd *SnapshotDesc) hidden() *SnapshotDesc {
+	hsd := *sd
+	hsd.ld = NewHiddenVolumeDesc(sd.ld)
+	return &hsd
+}
@@ -57,6 +57,7 @@ func NewCSIListingTokenFromBasedID(bid string, page int64, dc int64) (token CSIL
 
 	token.basedid = bid
 
+	token.dc = dc
 	if dc == 0 {
 		token.dc = rand.Int63()
 	}
@@ -91,24 +92,25 @@ func NewCSIListingTokenFromTokenString(ts string) (t *CSIListingToken, err jrest
 	parts := strings.Split(ts, "_")
 
 	if len(parts) < 2 {
-		return nil, jrest.GetError(jrest.RestErrorArgumentIncorrect, fmt.Sprintf("token %+v have bad format", t))
+		return nil, jrest.GetError(jrest.RestErrorArgumentIncorrect, fmt.Sprintf("token %s have bad format", ts))
 	}
 
 	if i, err := strconv.ParseInt(parts[0], 10, 64); err != nil {
-		return nil, jrest.GetError(jrest.RestErrorArgumentIncorrect, fmt.Sprintf("token %+v has bad page number %+v", t, err))
+		return nil, jrest.GetError(jrest.RestErrorArgumentIncorrect, fmt.Sprintf("token %s has bad page number %+v", ts, err))
 	} else {
-		t.page = i
+		ct.page = i
 	}
 
 	if i, err := strconv.ParseInt(parts[1], 10, 64); err != nil {
-		return nil, jrest.GetError(jrest.RestErrorArgumentIncorrect, fmt.Sprintf("token %+v has bad dc number %+v", t, err))
+		return nil, jrest.GetError(jrest.RestErrorArgumentIncorrect, fmt.Sprintf("token %s has bad dc number %+v", ts, err))
 	} else {
-		t.dc = i
+		ct.dc = i
 	}
 
 	if len(parts) >= 3 {
-		t.basedid = strings.Join(parts[2:], "_")
+		ct.basedid = strings.Join(parts[2:], "_")
 	}
+	ct.token = ts
 	return &ct, nil
 }
 
@@ -25,7 +25,7 @@ import (
 )
 
 func TargetIQN(prefix string, ld LunDesc) (*string, jrest.RestError) {
-	iqn := fmt.Sprintf("%s:%x", prefix, sha256.Sum256([]byte(ld.VDS())))
+	iqn := fmt.Sprintf("%s:%x", prefix, sha256.Sum256([]byte(ld.Path())))
 
 	if len(iqn) > 255 {
 		return nil, jrest.GetError(jrest.RestErrorArgumentIncorrect, fmt.Sprintf("Resulting target name is too long %s", iqn))
@@ -6,19 +6,21 @@ import (
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	jcom "joviandss-kubernetescsi/pkg/common"
 )
 
 type IdentityPlugin struct {
-	l *log.Entry
+	l         *log.Entry
+	readiness *Readiness
 }
 
 func (ip *IdentityPlugin) GetPluginInfo(ctx context.Context, req *csi.GetPluginInfoRequest) (*csi.GetPluginInfoResponse, error) {
 	l := ip.l.WithFields(log.Fields{
-		"request": "GetPluginInfo",
-		"func":    "GetPluginInfo",
-		"section": "identity",
+		jcom.FieldRPC: "GetPluginInfo",
+		"func":        "GetPluginInfo",
+		"section":     "identity",
 	})
 	ctx = jcom.WithLogger(ctx, l)
 	l.Debugf("Serving Plugin Info")
@@ -33,13 +35,28 @@ func (ip *IdentityPlugin) GetPluginInfo(ctx context.Context, req *csi.GetPluginI
 	}, nil
 }
 
-func GetIdentityPlugin(log *log.Entry) (ip *IdentityPlugin, err error) {
-	ip = &IdentityPlugin{l: log}
+// GetIdentityPlugin creates identity plugin, probe reports plugin as ready once readiness checks pass
+func GetIdentityPlugin(log *log.Entry, readiness *Readiness) (ip *IdentityPlugin, err error) {
+	if readiness == nil {
+		readiness = NewReadiness(ReadinessTTL)
+	}
+	ip = &IdentityPlugin{l: log, readiness: readiness}
 	return ip, nil
 }
 
+// Probe reports if plugin is able to serve requests
 func (ip *IdentityPlugin) Probe(ctx context.Context, req *csi.ProbeRequest) (*csi.ProbeResponse, error) {
-	return &csi.ProbeResponse{}, nil
+	l := ip.l.WithFields(log.Fields{
+		jcom.FieldRPC: "Probe",
+		"func":        "Probe",
+		"section":     "identity",
+	})
+
+	if err := ip.readiness.Check(ctx); err != nil {
+		l.Warnf("Plugin is not ready: %s", err)
+		return &csi.ProbeResponse{Ready: wrapperspb.Bool(false)}, nil
+	}
+	return &csi.ProbeResponse{Ready: wrapperspb.Bool(true)}, nil
 }
 
 func (ip *IdentityPlugin) GetPluginCapabilities(ctx context.Context, req *csi.GetPluginCapabilitiesRequest) (*csi.GetPluginCapabilitiesResponse, error) {
@@ -0,0 +1,83 @@
+package identity
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const (
+	// ReadinessTTL is a time readiness check result stays valid
+	ReadinessTTL = 15 * time.Second
+
+	// readinessTimeout limits time single readiness check may take
+	readinessTimeout = 10 * time.Second
+)
+
+// ReadinessCheck reports why part of the plugin is not able to serve requests, nil means it is ready
+type ReadinessCheck func(ctx context.Context) error
+
+// Readiness runs readiness checks of plugin services and caches result for TTL
+type Readiness struct {
+	mu      sync.Mutex
+	checks  []ReadinessCheck
+	ttl     time.Duration
+	checked time.Time
+	err     error
+}
+
+// NewReadiness creates readiness state that is evaluated with given checks
+func NewReadiness(ttl time.Duration, checks ...ReadinessCheck) *Readiness {
+	return &Readiness{
+		checks: checks,
+		ttl:    ttl,
+	}
+}
+
+// Check gives cached result of readiness checks, checks are run again once result expires
+func (r *Readiness) Check(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.checked.IsZero() && time.Since(r.checked) < r.ttl {
+		return r.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	r.err = nil
+	for _, check := range r.checks {
+		if err := check(ctx); err != nil {
+			r.err = err
+			break
+		}
+	}
+	// Result of interrupted check tells nothing about plugin
+	if ctx.Err() == context.Canceled {
+		return r.err
+	}
+	r.checked = time.Now()
+	return r.err
+}
+
+// LivenessHandler serves /healthz, it reports that plugin process is able to respond
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// ReadinessHandler serves /readyz, it reports result of readiness checks
+func (r *Readiness) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := r.Check(req.Context()); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
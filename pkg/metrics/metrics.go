@@ -0,0 +1,153 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+// Package metrics collects Prometheus metrics of CSI plugin
+package metrics
+
+import (
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/codes"
+)
+
+const namespace = "joviandss_csi"
+
+// iscsiSessionsGlob matches sessions of iSCSI initiator exposed by kernel
+const iscsiSessionsGlob = "/sys/class/iscsi_session/session*"
+
+// Registry holds all metrics of the plugin
+var Registry = prometheus.NewRegistry()
+
+var (
+	rpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_requests_total",
+		Help:      "Number of served CSI requests by method and gRPC code",
+	}, []string{"method", "code"})
+
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "Time spent serving CSI requests by method",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"method"})
+
+	restRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rest_requests_total",
+		Help:      "Number of JovianDSS REST calls by method, resource and REST error code, 0 stands for success",
+	}, []string{"method", "resource", "code"})
+
+	restDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rest_request_duration_seconds",
+		Help:      "Time spent on JovianDSS REST calls including retries by method and resource",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"method", "resource"})
+
+	poolSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pool_size_bytes",
+		Help:      "Size of JovianDSS pool",
+	}, []string{"pool"})
+
+	poolAvailable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pool_available_bytes",
+		Help:      "Space available on JovianDSS pool",
+	}, []string{"pool"})
+
+	iscsiLoginFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "iscsi_login_failures_total",
+		Help:      "Number of failed iSCSI target logins on the node",
+	})
+
+	iscsiSessions = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "iscsi_sessions",
+		Help:      "Number of iSCSI sessions on the node",
+	}, countISCSISessions)
+
+	registerNode sync.Once
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		rpcRequests,
+		rpcDuration,
+		restRequests,
+		restDuration,
+		poolSize,
+		poolAvailable,
+	)
+}
+
+// RegisterNode adds metrics that describe iSCSI state of the node
+func RegisterNode() {
+	registerNode.Do(func() {
+		Registry.MustRegister(iscsiLoginFailures, iscsiSessions)
+	})
+}
+
+// ObserveRPC records result and duration of CSI request
+func ObserveRPC(method string, code codes.Code, d time.Duration) {
+	rpcRequests.WithLabelValues(method, code.String()).Inc()
+	rpcDuration.WithLabelValues(method).Observe(d.Seconds())
+}
+
+// ObserveREST records REST error code and duration of JovianDSS REST call
+func ObserveREST(method string, resource string, code int, d time.Duration) {
+	restRequests.WithLabelValues(method, resource, strconv.Itoa(code)).Inc()
+	restDuration.WithLabelValues(method, resource).Observe(d.Seconds())
+}
+
+// SetPoolCapacity records size and available space of the pool,
+// negative size means that it is unknown and is not updated
+func SetPoolCapacity(pool string, size int64, available int64) {
+	if size >= 0 {
+		poolSize.WithLabelValues(pool).Set(float64(size))
+	}
+	poolAvailable.WithLabelValues(pool).Set(float64(available))
+}
+
+// ISCSILoginFailed records failed iSCSI login
+func ISCSILoginFailed() {
+	iscsiLoginFailures.Inc()
+}
+
+func countISCSISessions() float64 {
+	sessions, err := filepath.Glob(iscsiSessionsGlob)
+	if err != nil {
+		return 0
+	}
+	return float64(len(sessions))
+}
+
+// Handler serves metrics in Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,56 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package node
+
+import (
+	"os"
+
+	kexec "k8s.io/utils/exec"
+	"k8s.io/utils/mount"
+)
+
+// Host facilities used by node plugin to run iscsiadm, format and mount volumes
+// and to wait for block devices to appear
+var (
+	hostExec    kexec.Interface = kexec.New()
+	hostMounter mount.Interface = mount.New("")
+	hostStat    statFunc        = os.Stat
+)
+
+// Tools and host paths that have to be available for node plugin to stage and publish volumes
+var (
+	hostTools = []string{"iscsiadm", "blkid", "mount", "umount"}
+	hostPaths = []string{"/host/dev"}
+)
+
+// SetHostExecutors replaces facilities node plugin uses to reach the host
+//
+// It allows to run node plugin without iSCSI initiator and mount privileges,
+// for instance against k8s.io/utils/exec/testing and mount.FakeMounter in sanity tests.
+// Nil arguments keep current facility. Have to be called before node plugin serves requests
+func SetHostExecutors(e kexec.Interface, m mount.Interface, stat func(string) (os.FileInfo, error)) {
+	if e != nil {
+		hostExec = e
+	}
+	if m != nil {
+		hostMounter = m
+	}
+	if stat != nil {
+		hostStat = stat
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"k8s.io/utils/mount"
 
 	jcom "joviandss-kubernetescsi/pkg/common"
+	jmtr "joviandss-kubernetescsi/pkg/metrics"
 )
 
 var supportedNodeServiceCapabilities = []csi.NodeServiceCapability_RPC_Type{
@@ -23,7 +24,8 @@ var supportedNodeServiceCapabilities = []csi.NodeServiceCapability_RPC_Type{
 // NodePlugin responsible for attaching and detaching volumes to host
 type NodePlugin struct {
 	//cfg *NodeCfg
-	l *log.Entry
+	l     *log.Entry
+	locks *jcom.KeyLock
 }
 
 // GetNodePlugin inits NodePlugin
@@ -35,15 +37,45 @@ func GetNodePlugin(l *log.Entry) (*NodePlugin, error) {
 	}
 	var np NodePlugin
 
+	np.locks = jcom.NewKeyLock()
 	np.l = l.WithFields(log.Fields{
 		"nodeid":  nid,
 		"section": "node",
 	})
 
+	jmtr.RegisterNode()
+
 	l.Debug("Init node plugin")
 	return &np, nil
 }
 
+// lockVolume marks volume as being operated on, it fails with ABORTED if other operation on volume is in progress
+func (np *NodePlugin) lockVolume(vID string) error {
+	if !np.locks.TryLock(vID) {
+		return status.Errorf(codes.Aborted, "Operation on volume %s is already in progress", vID)
+	}
+	return nil
+}
+
+func (np *NodePlugin) unlockVolume(vID string) {
+	np.locks.Unlock(vID)
+}
+
+// Ready checks that tools and host paths node plugin relies on are available
+func (np *NodePlugin) Ready(ctx context.Context) error {
+	for _, tool := range hostTools {
+		if _, err := hostExec.LookPath(tool); err != nil {
+			return fmt.Errorf("%s is not available: %s", tool, err)
+		}
+	}
+	for _, p := range hostPaths {
+		if _, err := hostStat(p); err != nil {
+			return fmt.Errorf("host path %s is not available: %s", p, err)
+		}
+	}
+	return nil
+}
+
 // NodeExpandVolume responsible for update of file system on volume
 func (np *NodePlugin) NodeExpandVolume(ctx context.Context, in *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
 	np.l.Trace("Expanding Volume")
@@ -57,9 +89,9 @@ func (np *NodePlugin) NodeGetInfo(
 	req *csi.NodeGetInfoRequest) (*csi.NodeGetInfoResponse, error) {
 
 	l := np.l.WithFields(log.Fields{
-		"request": "NoneGetInfo",
-		"func":    "NodeGetInfo",
-		"section": "node",
+		jcom.FieldRPC: "NodeGetInfo",
+		"func":        "NodeGetInfo",
+		"section":     "node",
 	})
 
 	if nid, err := GetNodeId(l); err != nil {
@@ -79,14 +111,14 @@ func (np *NodePlugin) NodeStageVolume(
 ) (*csi.NodeStageVolumeResponse, error) {
 
 	l := np.l.WithFields(log.Fields{
-		"request": "NoneStageVolume",
-		"func":    "NodeStageVolume",
-		"section": "node",
+		jcom.FieldRPC:      "NodeStageVolume",
+		jcom.FieldVolumeID: req.GetVolumeId(),
+		"func":             "NodeStageVolume",
+		"section":          "node",
 	})
 	ctx = jcom.WithLogger(ctx, l)
 
-	l.Debug("Node Stage Volume")
-	l.Debugf("Stage Volume request %+v", *req)
+	l.Debugf("Node Stage Volume %s at %s", req.GetVolumeId(), req.GetStagingTargetPath())
 	var msg string
 
 	t, err := GetTargetFromReq(ctx, *req)
@@ -95,6 +127,11 @@ func (np *NodePlugin) NodeStageVolume(
 	if err != nil {
 		return nil, err
 	}
+
+	if err = np.lockVolume(req.GetVolumeId()); err != nil {
+		return nil, err
+	}
+	defer np.unlockVolume(req.GetVolumeId())
 	var exists bool
 	if exists, err = mount.PathExists(t.STPath); err != nil {
 		msg = fmt.Sprintf("Unable to check file %s for volume %s. Err: %s", t.STPath, t.Tname, err.Error())
@@ -135,9 +172,10 @@ func (np *NodePlugin) NodeUnstageVolume(
 	// Log out from specified target
 	var msg string
 	l := np.l.WithFields(log.Fields{
-		"request": "NoneUnstageVolume",
-		"func":    "NodeUnstageVolume",
-		"section": "node",
+		jcom.FieldRPC:      "NodeUnstageVolume",
+		jcom.FieldVolumeID: req.GetVolumeId(),
+		"func":             "NodeUnstageVolume",
+		"section":          "node",
 	})
 	ctx = jcom.WithLogger(ctx, l)
 
@@ -157,6 +195,11 @@ func (np *NodePlugin) NodeUnstageVolume(
 		return nil, status.Error(codes.InvalidArgument, msg)
 	}
 
+	if err := np.lockVolume(vname); err != nil {
+		return nil, err
+	}
+	defer np.unlockVolume(vname)
+
 	if GetStageStatus(stp) == false {
 		return &csi.NodeUnstageVolumeResponse{}, nil
 	}
@@ -184,16 +227,15 @@ func (np *NodePlugin) NodePublishVolume(
 	// TODO: ValidateCapability()
 
 	l := np.l.WithFields(log.Fields{
-		"request": "NodePublishVolume",
-		"func":    "NodePublishVolume",
-		"section": "node",
+		jcom.FieldRPC:      "NodePublishVolume",
+		jcom.FieldVolumeID: req.GetVolumeId(),
+		"func":             "NodePublishVolume",
+		"section":          "node",
 	})
 
 	ctx = jcom.WithLogger(ctx, l)
 
-	l.Debugf("Node Publish Volume %s", req.GetVolumeId())
-
-	l.Debugf("Publish Volume request %+v", *req)
+	l.Debugf("Node Publish Volume %s from %s to %s", req.GetVolumeId(), req.GetStagingTargetPath(), req.GetTargetPath())
 
 	block := false
 	var msg string
@@ -203,6 +245,11 @@ func (np *NodePlugin) NodePublishVolume(
 		return nil, err
 	}
 
+	if err = np.lockVolume(req.GetVolumeId()); err != nil {
+		return nil, err
+	}
+	defer np.unlockVolume(req.GetVolumeId())
+
 	if !block {
 		err = t.FormatMountVolume(req)
 	} else {
@@ -225,9 +272,10 @@ func (np *NodePlugin) NodeUnpublishVolume(
 ) (*csi.NodeUnpublishVolumeResponse, error) {
 
 	l := np.l.WithFields(log.Fields{
-		"request": "NodeUnpublishVolume",
-		"func":    "NodeUnpublishVolume",
-		"section": "node",
+		jcom.FieldRPC:      "NodeUnpublishVolume",
+		jcom.FieldVolumeID: req.GetVolumeId(),
+		"func":             "NodeUnpublishVolume",
+		"section":          "node",
 	})
 
 	ctx = jcom.WithLogger(ctx, l)
@@ -245,6 +293,11 @@ func (np *NodePlugin) NodeUnpublishVolume(
 		return nil, status.Error(codes.InvalidArgument, msg)
 	}
 
+	if err := np.lockVolume(req.GetVolumeId()); err != nil {
+		return nil, err
+	}
+	defer np.unlockVolume(req.GetVolumeId())
+
 	t, err := GetTarget(l, tp)
 	if err != nil {
 		return nil, err
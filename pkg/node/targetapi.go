@@ -25,7 +25,6 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	//"strconv"
 	"strings"
@@ -36,10 +35,10 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"gopkg.in/yaml.v2"
-	kexec "k8s.io/utils/exec"
 	"k8s.io/utils/mount"
 
 	jcom "joviandss-kubernetescsi/pkg/common"
+	jmtr "joviandss-kubernetescsi/pkg/metrics"
 )
 
 const (
@@ -367,8 +366,8 @@ func (t *Target) FormatMountVolume(req *csi.NodePublishVolumeRequest) error {
 	var err error
 	var msg string
 	m := mount.SafeFormatAndMount{
-		Interface: mount.New(""),
-		Exec:      kexec.New()}
+		Interface: hostMounter,
+		Exec:      hostExec}
 
 	if exists, err := mount.PathExists(t.TPath); exists == false {
 		if err = os.MkdirAll(t.TPath, 0640); err != nil {
@@ -403,7 +402,7 @@ func (t *Target) UnMountVolume(ctx context.Context) error {
 		"section": "node",
 	})
 
-	m := mount.New("")
+	m := hostMounter
 
 	devices, mCount, err := mount.GetDeviceNameFromMount(m, t.TPath)
 	if err != nil {
@@ -463,7 +462,7 @@ func (t *Target) StageVolume(ctx context.Context) error {
 
 	devicePath := strings.Join([]string{deviceIPPath, fullPortal, "iscsi", t.Iqn, "lun", t.Lun}, "-")
 
-	out, err := exec.Command("iscsiadm", "-m", "node", "-p", t.Portal, "-T", t.Iqn, "-o", "new").Output()
+	out, err := hostExec.Command("iscsiadm", "-m", "node", "-p", t.Portal, "-T", t.Iqn, "-o", "new").Output()
 	if err != nil {
 		msg := fmt.Sprintf("Unable to add targetation %s error: %s", t.Iqn, err.Error())
 		return errors.New(msg)
@@ -480,11 +479,12 @@ func (t *Target) StageVolume(ctx context.Context) error {
 	//Attach Target
 	// iscsiadm --mode discovery --op update --type sendtargets --portal targetIP
 	// iscsiadm -m node -p 172.29.0.1 -T someiqn --login
-	out, err = exec.Command("iscsiadm", "-m", "node", "-p", t.Portal, "-T", t.Iqn, "--login").Output()
+	out, err = hostExec.Command("iscsiadm", "-m", "node", "-p", t.Portal, "-T", t.Iqn, "--login").Output()
 	if err != nil {
+		jmtr.ISCSILoginFailed()
 		//t.ClearChapCred()
-		exec.Command("iscsiadm", "-m", "node", "-p", t.Portal, "-T", t.Iqn, "--logout").Run()
-		exec.Command("iscsiadm", "-m", "node", "-p", t.Portal, "-T", t.Iqn, "-o", "delete").Run()
+		hostExec.Command("iscsiadm", "-m", "node", "-p", t.Portal, "-T", t.Iqn, "--logout").Run()
+		hostExec.Command("iscsiadm", "-m", "node", "-p", t.Portal, "-T", t.Iqn, "-o", "delete").Run()
 		msg := fmt.Sprintf("iscsi: failed to attach disk: Error: %s (%v)", string(out), err)
 		return status.Errorf(codes.Internal, msg)
 	}
@@ -492,7 +492,7 @@ func (t *Target) StageVolume(ctx context.Context) error {
 	if exist := waitForPathToExist(&devicePath, 10, t.TProtocol); !exist {
 		l.Errorf("Could not attach disk to the path %s: Timeout after 10s", devicePath)
 		//t.ClearChapCred()
-		exec.Command("iscsiadm", "-m", "node", "-p", t.Portal, "-T", t.Iqn, "-o", "delete").Run()
+		hostExec.Command("iscsiadm", "-m", "node", "-p", t.Portal, "-T", t.Iqn, "-o", "delete").Run()
 		msg := "Could not attach disk: Timeout after 10s"
 		return status.Errorf(codes.Internal, msg)
 	}
@@ -529,8 +529,8 @@ func (t *Target) UnStageVolume(ctx context.Context) error {
 	//	return errors.New(msg)
 	//}
 
-	exec.Command("iscsiadm", "-m", "node", "-p", portal, "-T", t.Iqn, "--logout").Run()
-	exec.Command("iscsiadm", "-m", "node", "-p", portal, "-T", t.Iqn, "-o", "delete").Run()
+	hostExec.Command("iscsiadm", "-m", "node", "-p", portal, "-T", t.Iqn, "--logout").Run()
+	hostExec.Command("iscsiadm", "-m", "node", "-p", portal, "-T", t.Iqn, "-o", "delete").Run()
 
 	return nil
 }
@@ -539,7 +539,7 @@ type statFunc func(string) (os.FileInfo, error)
 type globFunc func(string) ([]string, error)
 
 func waitForPathToExist(devicePath *string, maxRetries int, deviceTransport string) bool {
-	return waitForPathToExistInternal(devicePath, maxRetries, deviceTransport, os.Stat, filepath.Glob)
+	return waitForPathToExistInternal(devicePath, maxRetries, deviceTransport, hostStat, filepath.Glob)
 }
 
 func waitForPathToExistInternal(devicePath *string, maxRetries int, deviceTransport string, osStat statFunc, filepathGlob globFunc) bool {
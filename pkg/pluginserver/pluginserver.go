@@ -19,17 +19,24 @@ package pluginserver
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"os"
+	"path"
+	"sync"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
-	//"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"joviandss-kubernetescsi/pkg/common"
 	jcntr "joviandss-kubernetescsi/pkg/controller"
 	jidnt "joviandss-kubernetescsi/pkg/identity"
+	jmtr "joviandss-kubernetescsi/pkg/metrics"
 	jnode "joviandss-kubernetescsi/pkg/node"
 )
 
@@ -40,19 +47,60 @@ const (
 )
 
 type PluginServer struct {
-	server   *grpc.Server
-	listener *net.Listener
-	l        *logrus.Entry
+	server    *grpc.Server
+	listener  *net.Listener
+	netType   string
+	addr      string
+	readiness *jidnt.Readiness
+	cp        *jcntr.ControllerPlugin
+	l         *logrus.Entry
+
+	// identities of clients allowed to call plugin, any client is allowed if empty
+	allowedClients map[string]struct{}
+
+	// background activities of plugins run until it is canceled by stopBackground
+	bgCtx          context.Context
+	stopBackground context.CancelFunc
+
+	inflightMu  sync.Mutex
+	inflightSeq uint64
+	inflight    map[uint64]inflight
 }
 
-func GetPluginServer(cfg *common.JovianDSSCfg, l *logrus.Entry, netType *string, addr *string, cntrSrv bool, nodeSrv bool, identitySrv bool) (s *PluginServer, err error) {
-	s = &PluginServer{}
+func GetPluginServer(cfg *common.JovianDSSCfg, l *logrus.Entry, netType *string, addr *string, lc *ListenerCfg, cntrSrv bool, nodeSrv bool, identitySrv bool) (s *PluginServer, err error) {
+	s = &PluginServer{
+		netType:        *netType,
+		addr:           *addr,
+		inflight:       make(map[uint64]inflight),
+		allowedClients: make(map[string]struct{}),
+	}
+	if lc == nil {
+		lc = &ListenerCfg{}
+	}
+	s.bgCtx, s.stopBackground = context.WithCancel(context.Background())
 
 	l = l.WithFields(logrus.Fields{
 		"func":    "GetPluginServer",
 		"section": "PluginServer",
 	})
 	s.l = l
+
+	if err = lc.validate(*netType); err != nil {
+		s.l.Warnf("Incorrect listener config: %s", err)
+		return nil, err
+	}
+	opts, err := lc.serverOptions(l)
+	if err != nil {
+		s.l.Warnf("Unable to setup TLS: %s", err)
+		return nil, err
+	}
+	if *netType != "unix" && len(opts) == 0 {
+		s.l.Warnf("Listening on %s %s without TLS, anyone who can reach it is able to call plugin", *netType, *addr)
+	}
+	for _, c := range lc.AllowedClients {
+		s.allowedClients[c] = struct{}{}
+	}
+
 	if *netType == "unix" {
 		if err := os.Remove(*addr); err != nil && !os.IsNotExist(err) {
 			s.l.Warnf("Unable to clear unix socket %s. Error: %s", *addr, err)
@@ -60,23 +108,28 @@ func GetPluginServer(cfg *common.JovianDSSCfg, l *logrus.Entry, netType *string,
 		}
 	}
 
-	listener, err := net.Listen(*netType, *addr)
+	var listener net.Listener
+	if *netType == "unix" {
+		listener, err = lc.listenUnix(*addr)
+	} else {
+		listener, err = net.Listen(*netType, *addr)
+	}
 	s.listener = &listener
 	if err != nil {
 		s.l.Warnf("Unable to start listening socket %s %s. Error %s", *netType, *addr, err)
 		return nil, err
 	}
 
-	s.server = grpc.NewServer(grpc.UnaryInterceptor(s.grpcErrorHandler), grpc.MaxConcurrentStreams(128))
-
-	if identitySrv {
-		ip, err := jidnt.GetIdentityPlugin(l)
-		if err != nil {
-			l.Warnf("Unable to setup Identity Plugin: %s", err)
-		}
-		csi.RegisterIdentityServer(s.server, ip)
-		l.Info("Register Identity Plugin")
+	interceptors := []grpc.UnaryServerInterceptor{s.recoverPanic, s.traceRequest}
+	if len(s.allowedClients) > 0 {
+		interceptors = append(interceptors, s.authorizeClient)
 	}
+	interceptors = append(interceptors, s.trackRequest, s.observeRequest, s.grpcErrorHandler)
+
+	opts = append(opts, grpc.ChainUnaryInterceptor(interceptors...), grpc.MaxConcurrentStreams(128))
+	s.server = grpc.NewServer(opts...)
+
+	var checks []jidnt.ReadinessCheck
 
 	if cntrSrv {
 		var cp jcntr.ControllerPlugin
@@ -85,9 +138,16 @@ func GetPluginServer(cfg *common.JovianDSSCfg, l *logrus.Entry, netType *string,
 			l.Info("Register Controller Plugin")
 
 			csi.RegisterControllerServer(s.server, &cp)
+			cp.StartGC(s.bgCtx)
+			s.cp = &cp
+			checks = append(checks, cp.Ready)
 
 		} else {
 			l.Warnf("Unable to create Controller Plugin: %s", err)
+			setupErr := err
+			checks = append(checks, func(ctx context.Context) error {
+				return fmt.Errorf("controller plugin is not set up: %s", setupErr)
+			})
 		}
 
 	}
@@ -95,19 +155,63 @@ func GetPluginServer(cfg *common.JovianDSSCfg, l *logrus.Entry, netType *string,
 	if nodeSrv {
 		if np, err := jnode.GetNodePlugin(l); err != nil {
 			l.Warnf("Unable to create Node Plugin: %s", err.Error())
+			s.stopBackground()
+			listener.Close()
 			return nil, err
 		} else {
 			l.Debug("Register Node Plugin")
 
 			csi.RegisterNodeServer(s.server, np)
+			checks = append(checks, np.Ready)
 		}
 
 	}
 
+	s.readiness = jidnt.NewReadiness(jidnt.ReadinessTTL, checks...)
+
+	if identitySrv {
+		ip, err := jidnt.GetIdentityPlugin(l, s.readiness)
+		if err != nil {
+			l.Warnf("Unable to setup Identity Plugin: %s", err)
+		}
+		csi.RegisterIdentityServer(s.server, ip)
+		l.Info("Register Identity Plugin")
+	}
+
 	return s, nil
 
 }
 
+// Readiness gives readiness state of plugins served by the server
+func (s *PluginServer) Readiness() *jidnt.Readiness {
+	return s.readiness
+}
+
+// WatchConfig reloads controller configuration every time config file at path changes,
+// file is checked every interval until server is shut down
+func (s *PluginServer) WatchConfig(path string, interval time.Duration) {
+	if s.cp == nil {
+		return
+	}
+	l := s.l.WithFields(logrus.Fields{
+		"func": "WatchConfig",
+	})
+
+	go common.WatchFile(s.bgCtx, path, interval, l, func(content []byte) {
+		var cfg common.JovianDSSCfg
+		if err := common.ParseConfig(content, &cfg); err != nil {
+			l.Errorf("Unable to parse config, keeping previous one: %s", err)
+			return
+		}
+		for _, d := range cfg.Deprecations() {
+			l.Warn(d)
+		}
+		if err := s.cp.Reload(&cfg); err != nil {
+			l.Errorf("Unable to apply config, keeping previous one: %s", err)
+		}
+	})
+}
+
 func (s *PluginServer) Run() (err error) {
 	err = s.server.Serve(*s.listener)
 	if err != nil {
@@ -119,6 +223,71 @@ func (s *PluginServer) Run() (err error) {
 	return nil
 }
 
+// maxTraceIDLen limits length of trace ID accepted from caller
+const maxTraceIDLen = 128
+
+// traceRequest assigns trace ID to request, ID given by caller in metadata is used if present
+//
+// Trace ID is passed back in response header, it is added to logs and REST calls made on behalf of request
+func (s *PluginServer) traceRequest(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	traceId := requestTraceID(ctx)
+
+	if err := grpc.SetHeader(ctx, metadata.Pairs(common.RequestIDHeader, traceId)); err != nil {
+		s.l.WithField(common.FieldTraceID, traceId).Debugf("Unable to set response header: %s", err)
+	}
+	s.l.WithFields(logrus.Fields{
+		"func":              "traceRequest",
+		common.FieldTraceID: traceId,
+	}).Tracef("Serving %s", info.FullMethod)
+
+	return handler(common.WithTraceID(ctx, traceId), req)
+}
+
+// requestTraceID gives trace ID of request, that is the one already assigned to context,
+// the one given by caller in metadata or newly generated one
+func requestTraceID(ctx context.Context) string {
+	if traceId := common.TraceID(ctx); len(traceId) > 0 {
+		return traceId
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(common.RequestIDHeader); len(ids) > 0 && validTraceID(ids[0]) {
+			return ids[0]
+		}
+	}
+	return common.NewTraceID()
+}
+
+// validTraceID checks that trace ID is safe to put in logs and HTTP headers
+func validTraceID(id string) bool {
+	if len(id) == 0 || len(id) > maxTraceIDLen {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// observeRequest records result and duration of request in metrics
+func (s *PluginServer) observeRequest(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	jmtr.ObserveRPC(path.Base(info.FullMethod), status.Code(err), time.Since(start))
+	return resp, err
+}
+
 func (s *PluginServer) grpcErrorHandler(
 	ctx context.Context,
 	req interface{},
@@ -127,8 +296,22 @@ func (s *PluginServer) grpcErrorHandler(
 ) (interface{}, error) {
 	resp, err := handler(ctx, req)
 	if err != nil {
+		// Request failed because caller gave up or ran out of time,
+		// whatever storage replied it have to be reported accordingly
+		switch ctx.Err() {
+		case context.DeadlineExceeded:
+			if status.Code(err) != codes.DeadlineExceeded {
+				err = status.Error(codes.DeadlineExceeded, err.Error())
+			}
+		case context.Canceled:
+			if status.Code(err) != codes.Canceled {
+				err = status.Error(codes.Canceled, err.Error())
+			}
+		}
 		s.l.WithFields(logrus.Fields{
-			"func": "grpcErrorhandler"}).Warn(err.Error())
+			"func":              "grpcErrorhandler",
+			common.FieldTraceID: common.TraceID(ctx),
+			"method":            info.FullMethod}).Warn(err.Error())
 	}
 	return resp, err
 }
@@ -0,0 +1,63 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package pluginserver
+
+import (
+	"context"
+	"path"
+	"runtime/debug"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"joviandss-kubernetescsi/pkg/common"
+	jmtr "joviandss-kubernetescsi/pkg/metrics"
+)
+
+// recoverPanic turns panic in request handler or other interceptors into Internal error,
+// so that single broken request does not bring down the whole plugin
+//
+// It is the outermost interceptor, so it assigns trace ID to request to report panic with it
+func (s *PluginServer) recoverPanic(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (resp interface{}, err error) {
+	traceId := requestTraceID(ctx)
+	start := time.Now()
+
+	defer func() {
+		if r := recover(); r != nil {
+			s.l.WithFields(logrus.Fields{
+				"func":              "recoverPanic",
+				common.FieldTraceID: traceId,
+				"method":            info.FullMethod,
+				"stack":             string(debug.Stack()),
+			}).Errorf("Request handler panicked: %v", r)
+			// observeRequest is interrupted by panic, so request is recorded here
+			jmtr.ObserveRPC(path.Base(info.FullMethod), codes.Internal, time.Since(start))
+			resp = nil
+			err = status.Errorf(codes.Internal, "Internal error while serving request %s", traceId)
+		}
+	}()
+	return handler(common.WithTraceID(ctx, traceId), req)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package pluginserver
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kubernetes-csi/csi-test/v5/pkg/sanity"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/sirupsen/logrus"
+	testingexec "k8s.io/utils/exec/testing"
+	"k8s.io/utils/mount"
+
+	"joviandss-kubernetescsi/pkg/common"
+	jnode "joviandss-kubernetescsi/pkg/node"
+	"joviandss-kubernetescsi/pkg/rest/fake"
+)
+
+const testPool = "Pool-0"
+
+func testLogger() *logrus.Entry {
+	l := logrus.New()
+	l.Out = io.Discard
+	return logrus.NewEntry(l)
+}
+
+// sanitySkip lists specs that do not apply to the plugin
+var sanitySkip = []string{
+	// Controller keeps no registry of nodes and does not use node ID for publishing,
+	// target is not restricted to initiator of the node since initiator ACLs and CHAP are not supported.
+	// So there is nothing to tell that node does not exist, node that is gone simply never logs in
+	"should fail when the node does not exist",
+}
+
+// TestSanity runs csi-sanity suite against plugin that serves all CSI services on unix socket
+//
+// Controller is connected to fake JovianDSS REST server, node plugin runs no host commands,
+// every command succeeds with empty output and mounts are only recorded
+func TestSanity(t *testing.T) {
+	s := fake.NewServer(testPool)
+	defer s.Close()
+	s.SetCredentials("admin", "admin")
+
+	dir := t.TempDir()
+	devices := filepath.Join(dir, "dev")
+	if err := os.Mkdir(devices, 0o750); err != nil {
+		t.Fatalf("unable to create devices directory: %s", err)
+	}
+	jnode.SetHostExecutors(
+		&testingexec.FakeExec{
+			DisableScripts: true,
+			LookPathFunc:   func(file string) (string, error) { return "/usr/sbin/" + file, nil },
+		},
+		mount.NewFakeMounter(nil),
+		// Any block device appears right after iSCSI login
+		func(string) (os.FileInfo, error) { return os.Stat(devices) },
+	)
+
+	// Version is given at build time
+	if len(common.Version) == 0 {
+		common.Version = "sanity"
+	}
+
+	cfg := common.JovianDSSCfg{
+		LLevel:          "error",
+		LDest:           os.DevNull,
+		Pool:            testPool,
+		RestEndpointCfg: s.EndpointCfg(),
+	}
+	cfg.ISCSIEndpointCfg.Addrs = []string{"127.0.0.1"}
+
+	netType := "unix"
+	addr := filepath.Join(dir, "csi.sock")
+	ps, err := GetPluginServer(&cfg, testLogger(), &netType, &addr, nil, true, true, true)
+	if err != nil {
+		t.Fatalf("unable to start plugin server: %s", err)
+	}
+	go ps.Run()
+	defer ps.Shutdown(time.Second)
+
+	sc := sanity.NewTestConfig()
+	sc.Address = "unix://" + addr
+	sc.TargetPath = filepath.Join(dir, "target")
+	sc.StagingPath = filepath.Join(dir, "staging")
+	sc.TestVolumeSize = 1 << 30
+	sc.IdempotentCount = 2
+
+	sanity.GinkgoTest(&sc)
+	gomega.RegisterFailHandler(ginkgo.Fail)
+
+	suiteCfg, reporterCfg := ginkgo.GinkgoConfiguration()
+	suiteCfg.SkipStrings = append(suiteCfg.SkipStrings, sanitySkip...)
+	ginkgo.RunSpecs(t, "CSI Driver Test Suite", suiteCfg, reporterCfg)
+}
@@ -0,0 +1,232 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package pluginserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"joviandss-kubernetescsi/pkg/common"
+)
+
+// ListenerCfg stores properties that protect gRPC listener
+//
+// TLS properties apply to tcp sockets, socket mode and owner apply to unix sockets
+type ListenerCfg struct {
+	TLSCert        string      // path to PEM encoded server certificate
+	TLSKey         string      // path to PEM encoded server key
+	ClientCA       string      // path to PEM encoded CA certificates that client certificates are verified against
+	AllowedClients []string    // identities of clients that are allowed to call plugin, common names or subject alternative names
+	SocketMode     os.FileMode // permissions of unix socket, left as is if 0
+	SocketOwner    string      // owner of unix socket in user:group form, names or numeric ids
+}
+
+// validate checks that listener properties are consistent with each other and with socket type
+func (lc *ListenerCfg) validate(netType string) error {
+	if (len(lc.TLSCert) == 0) != (len(lc.TLSKey) == 0) {
+		return fmt.Errorf("TLS certificate and key have to be provided together")
+	}
+	if len(lc.ClientCA) > 0 && len(lc.TLSCert) == 0 {
+		return fmt.Errorf("client certificate verification requires server TLS certificate")
+	}
+	if len(lc.AllowedClients) > 0 && len(lc.ClientCA) == 0 {
+		return fmt.Errorf("allowed clients require client certificate verification")
+	}
+	if netType == "unix" {
+		if len(lc.TLSCert) > 0 {
+			return fmt.Errorf("TLS is supported for tcp sockets only")
+		}
+	} else if lc.SocketMode != 0 || len(lc.SocketOwner) > 0 {
+		return fmt.Errorf("socket mode and owner are supported for unix sockets only")
+	}
+	return nil
+}
+
+// serverOptions gives gRPC server options that set up TLS according to config
+func (lc *ListenerCfg) serverOptions(l *logrus.Entry) ([]grpc.ServerOption, error) {
+	if len(lc.TLSCert) == 0 {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(lc.TLSCert, lc.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load TLS certificate: %s", err)
+	}
+
+	tc := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if len(lc.ClientCA) > 0 {
+		pem, err := os.ReadFile(lc.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client CA: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA %s", lc.ClientCA)
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+		l.Info("Client certificates are verified")
+	}
+
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(tc))}, nil
+}
+
+// listenUnix starts listening on unix socket with permissions and owner from config
+//
+// Socket is created in private directory and moved to its place once it is secured,
+// so it is never reachable with permissions that umask gives
+func (lc *ListenerCfg) listenUnix(addr string) (net.Listener, error) {
+	if lc.SocketMode == 0 && len(lc.SocketOwner) == 0 {
+		return net.Listen("unix", addr)
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(addr), ".socket-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to create private directory for socket %s: %s", addr, err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, filepath.Base(addr))
+	listener, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// Socket is moved, it is removed by its final name on shutdown
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if err = lc.secureSocket(tmp); err == nil {
+		if err = os.Rename(tmp, addr); err != nil {
+			err = fmt.Errorf("unable to move socket to %s: %s", addr, err)
+		}
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// secureSocket sets permissions and owner of unix socket
+func (lc *ListenerCfg) secureSocket(addr string) error {
+	if len(lc.SocketOwner) > 0 {
+		uid, gid, err := lookupOwner(lc.SocketOwner)
+		if err != nil {
+			return err
+		}
+		if err = os.Chown(addr, uid, gid); err != nil {
+			return fmt.Errorf("unable to change owner of socket %s: %s", addr, err)
+		}
+	}
+	if lc.SocketMode != 0 {
+		if err := os.Chmod(addr, lc.SocketMode); err != nil {
+			return fmt.Errorf("unable to change mode of socket %s: %s", addr, err)
+		}
+	}
+	return nil
+}
+
+// lookupOwner resolves user:group pair to numeric ids, group may be omitted to keep current one
+func lookupOwner(owner string) (uid int, gid int, err error) {
+	uname, gname, _ := strings.Cut(owner, ":")
+
+	uid, gid = -1, -1
+	if len(uname) > 0 {
+		if uid, err = strconv.Atoi(uname); err != nil {
+			u, lErr := user.Lookup(uname)
+			if lErr != nil {
+				return 0, 0, fmt.Errorf("unknown socket owner %s: %s", uname, lErr)
+			}
+			uid, _ = strconv.Atoi(u.Uid)
+		}
+	}
+	if len(gname) > 0 {
+		if gid, err = strconv.Atoi(gname); err != nil {
+			g, lErr := user.LookupGroup(gname)
+			if lErr != nil {
+				return 0, 0, fmt.Errorf("unknown socket group %s: %s", gname, lErr)
+			}
+			gid, _ = strconv.Atoi(g.Gid)
+		}
+	}
+	return uid, gid, nil
+}
+
+// clientIdentities gives names that client certificate is issued for
+func clientIdentities(ctx context.Context) []string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := info.State.VerifiedChains[0][0]
+	ids := []string{}
+	if len(cert.Subject.CommonName) > 0 {
+		ids = append(ids, cert.Subject.CommonName)
+	}
+	ids = append(ids, cert.DNSNames...)
+	ids = append(ids, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		ids = append(ids, u.String())
+	}
+	return ids
+}
+
+// authorizeClient rejects requests of clients whose certificate identity is not in allowlist
+func (s *PluginServer) authorizeClient(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	ids := clientIdentities(ctx)
+	for _, id := range ids {
+		if _, ok := s.allowedClients[id]; ok {
+			return handler(ctx, req)
+		}
+	}
+
+	s.l.WithFields(logrus.Fields{
+		"func":              "authorizeClient",
+		common.FieldTraceID: common.TraceID(ctx),
+		"method":            info.FullMethod,
+	}).Warnf("Rejecting request of client %v", ids)
+	return nil, status.Error(codes.PermissionDenied, "Client is not allowed to call plugin")
+}
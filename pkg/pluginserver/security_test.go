@@ -0,0 +1,78 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package pluginserver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenUnixSecuresSocket(t *testing.T) {
+	dir := t.TempDir()
+	addr := filepath.Join(dir, "csi.sock")
+
+	lc := ListenerCfg{
+		SocketMode:  0o600,
+		SocketOwner: fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+	}
+	listener, err := lc.listenUnix(addr)
+	if err != nil {
+		t.Fatalf("unable to listen on %s: %s", addr, err)
+	}
+	defer listener.Close()
+
+	fi, err := os.Stat(addr)
+	if err != nil {
+		t.Fatalf("socket is not in place: %s", err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != lc.SocketMode {
+		t.Errorf("socket has mode %s, expected socket with %s", fi.Mode(), lc.SocketMode)
+	}
+
+	// Private directory socket is created in does not stay behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unable to read socket directory: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("socket directory contains %d entries, expected socket only", len(entries))
+	}
+
+	conn, err := net.Dial("unix", addr)
+	if err != nil {
+		t.Fatalf("unable to connect to socket: %s", err)
+	}
+	conn.Close()
+}
+
+func TestListenUnixFailsToSecureSocket(t *testing.T) {
+	dir := t.TempDir()
+	addr := filepath.Join(dir, "csi.sock")
+
+	lc := ListenerCfg{SocketMode: 0o600, SocketOwner: "no-such-user-of-csi-plugin"}
+	if listener, err := lc.listenUnix(addr); err == nil {
+		listener.Close()
+		t.Fatalf("socket with unknown owner is created")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("socket directory is not clean after failure, it contains %d entries", len(entries))
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package pluginserver
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"joviandss-kubernetescsi/pkg/common"
+)
+
+// inflight describes request that is being served
+type inflight struct {
+	method  string
+	traceId string
+	start   time.Time
+}
+
+// trackRequest keeps record of requests being served, so that they can be reported on forced shutdown
+func (s *PluginServer) trackRequest(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	s.inflightMu.Lock()
+	s.inflightSeq++
+	id := s.inflightSeq
+	s.inflight[id] = inflight{
+		method:  info.FullMethod,
+		traceId: common.TraceID(ctx),
+		start:   time.Now(),
+	}
+	s.inflightMu.Unlock()
+
+	defer func() {
+		s.inflightMu.Lock()
+		delete(s.inflight, id)
+		s.inflightMu.Unlock()
+	}()
+
+	return handler(ctx, req)
+}
+
+// running gives requests that are being served, oldest first
+func (s *PluginServer) running() []inflight {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+
+	out := make([]inflight, 0, len(s.inflight))
+	for _, r := range s.inflight {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].start.Before(out[j].start) })
+	return out
+}
+
+// Shutdown stops accepting new requests and waits for requests being served to complete
+//
+// If requests do not complete within timeout they are interrupted and reported in log.
+// Background activities like garbage collection are stopped and unix socket is removed
+func (s *PluginServer) Shutdown(timeout time.Duration) {
+	l := s.l.WithFields(logrus.Fields{
+		"func": "Shutdown",
+	})
+
+	l.Infof("Shutting down, waiting up to %s for %d requests to complete", timeout, len(s.running()))
+	s.stopBackground()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		l.Info("All requests completed")
+	case <-time.After(timeout):
+		for _, r := range s.running() {
+			l.WithFields(logrus.Fields{
+				common.FieldTraceID: r.traceId,
+				"method":            r.method,
+			}).Warnf("Interrupting request running for %s", time.Since(r.start).Round(time.Millisecond))
+		}
+		s.server.Stop()
+		<-stopped
+	}
+
+	if s.netType == "unix" {
+		if err := os.Remove(s.addr); err != nil && !os.IsNotExist(err) {
+			l.Warnf("Unable to remove unix socket %s. Error: %s", s.addr, err)
+		}
+	}
+}
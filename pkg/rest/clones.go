@@ -28,7 +28,7 @@ import (
 
 func (s *RestEndpoint) GetVolumeSnapshotClones(ctx context.Context, pool string, vds string, sds string) (clones []ResourceVolumeSnapshotClones, err RestError) {
 
-	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/snapshots/%s/clones", pool, vds, sds)
+	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/snapshots/%s/clones", pool, volumePath(vds), sds)
 
 	l := s.l.WithFields(log.Fields{
 		"func":    "GetVolumeSnapshotClones",
@@ -54,7 +54,7 @@ func (s *RestEndpoint) GetVolumeSnapshotClones(ctx context.Context, pool string,
 		return clones, nil
 	}
 
-	return nil, getError(ctx, body)
+	return nil, getError(ctx, stat, body)
 
 }
 
@@ -68,7 +68,7 @@ func (s *RestEndpoint) GetVolumeSnapshotClones(ctx context.Context, pool string,
 //   - *desc* data, including new volume name, that would be transfered to create clone
 func (s *RestEndpoint) CreateClone(ctx context.Context, pool string, vid string, desc CloneVolumeDescriptor) RestError {
 
-	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/clone", pool, vid)
+	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/clone", pool, volumePath(vid))
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(log.Fields{
@@ -89,11 +89,11 @@ func (s *RestEndpoint) CreateClone(ctx context.Context, pool string, vid string,
 		return nil
 	}
 
-	return getError(ctx, body)
+	return getError(ctx, stat, body)
 }
 
 func (s *RestEndpoint) DeleteClone(ctx context.Context, pool string, vds string, sds string, cds string, desc DeleteVolumeDescriptor) RestError {
-	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/snapshots/%s/clones/%s", pool, vds, sds, cds)
+	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/snapshots/%s/clones/%s", pool, volumePath(vds), sds, volumePath(cds))
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(log.Fields{
@@ -114,5 +114,5 @@ func (s *RestEndpoint) DeleteClone(ctx context.Context, pool string, vds string,
 		return nil
 	}
 
-	return getError(ctx, body)
+	return getError(ctx, stat, body)
 }
@@ -51,9 +51,52 @@ func pagedcSuffix(addr string, page *int64, dc *int64) (out string) {
 	return addr
 }
 
-func (s *RestEndpoint) GetVolumeSnapshotsEntries(ctx context.Context, pool string, vname string, page int64, dc int64) (ent ResultEntries, err RestError) {
+func (s *RestEndpoint) GetVolumeSnapshotsEntries(ctx context.Context, pool string, vname string, page int64, dc int64) (ent *ResultEntries, err RestError) {
 
-	return ent, nil
+	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/snapshots", pool, volumePath(vname))
+
+	l := jcom.LFC(ctx)
+
+	l = l.WithFields(log.Fields{
+		"func":    "GetVolumeSnapshotsEntries",
+		"addr":    addr,
+		"section": "rest",
+	})
+
+	addr = pagedcSuffix(addr, &page, &dc)
+
+	l.Debugln("Sending")
+	stat, body, err := s.rp.Send(ctx, "GET", addr, nil, GetVolSnapshotsRCode)
+
+	if err != nil {
+		s.l.Warnf("Unable to get snapshot list for volume %s", vname)
+		return nil, err
+	}
+
+	var snaps []ResourceSnapshot
+	var entries = ResultEntries{Entries: &snaps}
+	var rsp = GeneralResponse{Data: &entries}
+
+	if errU := s.unmarshal(body, &rsp); errU != nil {
+		return nil, errU
+	}
+
+	switch stat {
+	case CodeOK, CodeCreated:
+		if rsp.Data != nil {
+			data, ok := rsp.Data.(*ResultEntries)
+
+			if ok {
+				return data, nil
+			}
+			return nil, GetError(RestErrorRequestMalfunction, fmt.Sprintf("response is not expected %+v", rsp.Data))
+		}
+	default:
+		if rsp.Error != nil {
+			return nil, ErrorFromErrorT(ctx, stat, rsp.Error, s.l)
+		}
+	}
+	return nil, ErrorFromErrorT(ctx, stat, rsp.Error, s.l)
 }
 
 func (s *RestEndpoint) GetVolumesEntries(ctx context.Context, pool string, page int64, dc int64) (ent *ResultEntries, err RestError) {
@@ -98,10 +141,10 @@ func (s *RestEndpoint) GetVolumesEntries(ctx context.Context, pool string, page
 		}
 	default:
 		if rsp.Error != nil {
-			return nil, ErrorFromErrorT(ctx, rsp.Error, s.l)
+			return nil, ErrorFromErrorT(ctx, stat, rsp.Error, s.l)
 		}
 	}
-	return nil, ErrorFromErrorT(ctx, rsp.Error, s.l)
+	return nil, ErrorFromErrorT(ctx, stat, rsp.Error, s.l)
 }
 
 func (s *RestEndpoint) GetSnapshotsEntries(ctx context.Context, pool string, page int64, dc int64) (ent *ResultEntries, err RestError) {
@@ -148,8 +191,8 @@ func (s *RestEndpoint) GetSnapshotsEntries(ctx context.Context, pool string, pag
 		}
 	default:
 		if rsp.Error != nil {
-			return nil, ErrorFromErrorT(ctx, rsp.Error, s.l)
+			return nil, ErrorFromErrorT(ctx, stat, rsp.Error, s.l)
 		}
 	}
-	return nil, ErrorFromErrorT(ctx, rsp.Error, s.l)
+	return nil, ErrorFromErrorT(ctx, stat, rsp.Error, s.l)
 }
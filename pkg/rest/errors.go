@@ -19,10 +19,17 @@ package rest
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"regexp"
 	"runtime/debug"
 	"strings"
+	"syscall"
 
 	"github.com/sirupsen/logrus"
 )
@@ -44,16 +51,71 @@ const (
 	RestErrorOutOfSpace                     = 13
 	RestErrorResourceDNEVolume              = 14
 	RestErrorResourceDNETarget              = 15
+	RestErrorRequestCanceled                = 16
+	RestErrorDeadlineExceeded               = 17
+	RestErrorServiceUnavailable             = 18 // storage temporary refuses to process requests
+	RestErrorCertificateInvalid             = 19 // storage certificate failed verification
 )
 
+// RestError describes failure of request to JovianDSS
+//
+// Besides the code that tells what kind of failure happened, it carries
+// data obtained from the storage, so that callers do not have to parse messages.
+// Errors can be compared by code with errors.Is and sentinel errors like ErrResourceDNE,
+// and obtained from the wrapping errors with errors.As
 type RestError interface {
 	Error() (out string)
 	GetCode() int
+
+	// Status gives HTTP status of the response, 0 if no response was received
+	Status() int
+
+	// Errno gives error number reported by JovianDSS, ok is false if it was not reported
+	Errno() (errno int, ok bool)
+
+	// Class gives class of the exception reported by JovianDSS, empty if it was not reported
+	Class() string
+
+	// Resources gives names of volumes, snapshots and targets affected by the failure, if they are known
+	Resources() []string
+
+	// Retryable tells if the same request might succeed if it is sent again later
+	Retryable() bool
 }
 
 type restError struct {
 	code int
 	msg  string
+
+	// error that caused failure, if any
+	cause error
+
+	status    int
+	errno     *int
+	class     string
+	resources []string
+}
+
+// Sentinel errors to compare with errors.Is
+//
+// Error matches sentinel with the same code, specific codes also match more general ones,
+// so that RestErrorResourceDNEVolume matches ErrResourceDNE
+var (
+	ErrResourceDNE     RestError = &restError{code: RestErrorResourceDNE}
+	ErrResourceExists  RestError = &restError{code: RestErrorResourceExists}
+	ErrResourceBusy    RestError = &restError{code: RestErrorResourceBusy}
+	ErrOutOfSpace      RestError = &restError{code: RestErrorOutOfSpace}
+	ErrUnableToConnect RestError = &restError{code: RestErrorUnableToConnect}
+	ErrRequestTimeout  RestError = &restError{code: RestErrorRequestTimeout}
+	ErrUnavailable     RestError = &restError{code: RestErrorServiceUnavailable}
+)
+
+// generalCode gives code that specific code is a particular case of
+var generalCode = map[int]int{
+	RestErrorResourceDNEVolume:              RestErrorResourceDNE,
+	RestErrorResourceDNETarget:              RestErrorResourceDNE,
+	RestErrorResourceBusySnapshotHasClones:  RestErrorResourceBusy,
+	RestErrorResourceBusyVolumeHasSnapshots: RestErrorResourceBusy,
 }
 
 func ErrCode(err RestError) int {
@@ -63,6 +125,55 @@ func ErrCode(err RestError) int {
 	return RestErrorOk
 }
 
+// ContextError gives error that reflects the reason context is done, nil if it is not
+func ContextError(ctx context.Context) RestError {
+	switch ctx.Err() {
+	case nil:
+		return nil
+	case context.DeadlineExceeded:
+		return &restError{code: RestErrorDeadlineExceeded, msg: "Request deadline exceeded"}
+	default:
+		return &restError{code: RestErrorRequestCanceled, msg: "Request was canceled"}
+	}
+}
+
+// networkError classifies failure of sending request or receiving response
+//
+// Failures that happen before request reaches the storage, like DNS resolution,
+// dialing or TLS handshake, are reported as RestErrorUnableToConnect.
+// Certificate verification failures are reported as RestErrorCertificateInvalid,
+// they would not go away on retry or on other address, since it is the same storage.
+// Timeouts and connections dropped by the storage are reported as RestErrorRequestTimeout,
+// as request might have been already processed by the storage.
+// Original error is kept as a cause
+func networkError(err error) *restError {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var authErr x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var certErr x509.CertificateInvalidError
+	var rootsErr x509.SystemRootsError
+	var recErr tls.RecordHeaderError
+	var netErr net.Error
+
+	switch {
+	// Verification errors are wrapped into dial errors, so they have to be checked first
+	case errors.As(err, &authErr), errors.As(err, &hostErr), errors.As(err, &certErr), errors.As(err, &rootsErr), errors.Is(err, errSPKIPinMismatch):
+		return &restError{code: RestErrorCertificateInvalid, msg: err.Error(), cause: err}
+	case errors.As(err, &dnsErr):
+		return &restError{code: RestErrorUnableToConnect, msg: fmt.Sprintf("unable to resolve %s: %s", dnsErr.Name, dnsErr.Err), cause: err}
+	case errors.As(err, &opErr) && opErr.Op == "dial", errors.Is(err, syscall.ECONNREFUSED):
+		return &restError{code: RestErrorUnableToConnect, msg: err.Error(), cause: err}
+	case errors.As(err, &recErr):
+		return &restError{code: RestErrorUnableToConnect, msg: fmt.Sprintf("TLS handshake failed: %s", err.Error()), cause: err}
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return &restError{code: RestErrorRequestTimeout, msg: err.Error(), cause: err}
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return &restError{code: RestErrorRequestTimeout, msg: fmt.Sprintf("connection closed by storage: %s", err.Error()), cause: err}
+	}
+	return &restError{code: RestErrorRequestMalfunction, msg: err.Error(), cause: err}
+}
+
 // TODO: Refactor to move logging of error message in this func
 func GetError(c int, m string) RestError {
 	out := restError{
@@ -119,7 +230,11 @@ var lunIdUsedMsgRegexp = regexp.MustCompile(lunIdUsedMsgPattern)
 var volumeAlteadyUsedRegexp = regexp.MustCompile(volumeAlreadyUsedPattern)
 var lunItemConflictClassRegexp = regexp.MustCompile(lunItemConflictClassPattern)
 
-func ErrorFromErrorT(ctx context.Context, err *ErrorT, le *logrus.Entry) *restError {
+// ErrorFromErrorT makes error out of the error reported by JovianDSS
+//
+// Error gets code according to the message and class of the reported exception,
+// if they are not recognised code is derived from HTTP status of the response
+func ErrorFromErrorT(ctx context.Context, stat int, err *ErrorT, le *logrus.Entry) *restError {
 
 	l := le.WithFields(logrus.Fields{
 		"func":    "ErrorFromErrorT",
@@ -132,8 +247,48 @@ func ErrorFromErrorT(ctx context.Context, err *ErrorT, le *logrus.Entry) *restEr
 		stackTrace := debug.Stack()
 		le.Warnln("Manual stack trace log:")
 		le.Warnln(string(stackTrace))
+
+		out := errorFromStatus(stat)
+		out.msg = fmt.Sprintf("storage responded with status %d and no error description", stat)
+		return out
 	}
 
+	out := classifyErrorT(err, l)
+	if out.code == RestErrorFailureUnknown {
+		if byStat := errorFromStatus(stat); byStat.code != RestErrorFailureUnknown {
+			out.code = byStat.code
+		}
+	}
+
+	out.status = stat
+	out.errno = err.Errno
+	if err.Class != nil {
+		out.class = *err.Class
+	}
+	if len(out.msg) == 0 && err.Message != nil {
+		out.msg = *err.Message
+	}
+	return out
+}
+
+// errorFromStatus gives error with code that corresponds to HTTP status of the response
+func errorFromStatus(stat int) *restError {
+	out := &restError{code: RestErrorFailureUnknown, status: stat}
+	switch stat {
+	case http.StatusNotFound:
+		out.code = RestErrorResourceDNE
+	case http.StatusConflict:
+		out.code = RestErrorResourceExists
+	case http.StatusServiceUnavailable:
+		// Storage is temporary unable to process requests, that does not tell anything about resource
+		out.code = RestErrorServiceUnavailable
+	}
+	return out
+}
+
+// classifyErrorT identifies failure by errno, class and message of the exception reported by JovianDSS
+func classifyErrorT(err *ErrorT, l *logrus.Entry) *restError {
+
 	l.Debugf("ErrorT data %+v", err)
 	if err.Errno != nil {
 		l.Warnln("Error number ", *err.Errno)
@@ -143,13 +298,8 @@ func ErrorFromErrorT(ctx context.Context, err *ErrorT, le *logrus.Entry) *restEr
 		case 0:
 			if err.Message != nil {
 				// Check if that is DNE message
-				if snapshotDneMsgRegexp.MatchString(*err.Message) {
-					if err.Class != nil {
-						if zfsCmdErrorRegexp.MatchString(*err.Class) {
-							return &restError{code: RestErrorResourceDNE}
-						}
-					}
-					return &restError{code: RestErrorResourceDNE}
+				if match := snapshotDneMsgRegexp.FindStringSubmatch(*err.Message); match != nil {
+					return &restError{code: RestErrorResourceDNE, msg: match[1], resources: match[1:2]}
 				}
 			}
 
@@ -160,7 +310,7 @@ func ErrorFromErrorT(ctx context.Context, err *ErrorT, le *logrus.Entry) *restEr
 					if len(match) > 1 {
 						msg := fmt.Sprintf("Resource %s not found", match[1])
 						l.Warnf(msg)
-						return &restError{code: RestErrorResourceDNE, msg: msg}
+						return &restError{code: RestErrorResourceDNE, msg: msg, resources: match[1:2]}
 					}
 					l.Warn("Resource not found")
 					return &restError{code: RestErrorResourceDNE, msg: *err.Message}
@@ -198,7 +348,8 @@ func ErrorFromErrorT(ctx context.Context, err *ErrorT, le *logrus.Entry) *restEr
 
 					msg := fmt.Sprintf("Snapshot %s has dependent resources %s", match[snapshot], strings.Replace(match[datasets], "\n", " ", -1))
 					l.Debug(msg)
-					return &restError{code: RestErrorResourceBusySnapshotHasClones, msg: msg}
+					return &restError{code: RestErrorResourceBusySnapshotHasClones, msg: msg,
+						resources: append([]string{match[snapshot]}, datasetNames(match[datasets])...)}
 				}
 				if volumeHasChildrenMsgRegexp.MatchString(*err.Message) {
 					match := volumeHasChildrenMsgRegexp.FindStringSubmatch(*err.Message)
@@ -207,7 +358,8 @@ func ErrorFromErrorT(ctx context.Context, err *ErrorT, le *logrus.Entry) *restEr
 
 					msg := fmt.Sprintf("Volume %s has dependent resources %s", match[volume], strings.Replace(match[datasets], "\n", " ", -1))
 					l.Debug(msg)
-					return &restError{code: RestErrorResourceBusyVolumeHasSnapshots, msg: msg}
+					return &restError{code: RestErrorResourceBusyVolumeHasSnapshots, msg: msg,
+						resources: append([]string{match[volume]}, datasetNames(match[datasets])...)}
 				}
 			}
 		}
@@ -215,7 +367,9 @@ func ErrorFromErrorT(ctx context.Context, err *ErrorT, le *logrus.Entry) *restEr
 		if err.Class != nil {
 			if err.Message != nil {
 				if targetNameConflictClassRegexp.MatchString(*err.Class) && targetExistsMsgRegexp.MatchString(*err.Message) {
-					return &restError{code: RestErrorResourceExists}
+					match := targetExistsMsgRegexp.FindStringSubmatch(*err.Message)
+					target := match[targetExistsMsgRegexp.SubexpIndex("target")]
+					return &restError{code: RestErrorResourceExists, msg: target, resources: []string{target}}
 				}
 				if lunItemConflictClassRegexp.MatchString(*err.Class) {
 					if lunIdUsedMsgRegexp.MatchString(*err.Message) {
@@ -226,8 +380,9 @@ func ErrorFromErrorT(ctx context.Context, err *ErrorT, le *logrus.Entry) *restEr
 					}
 				}
 				if itemNotFoundClassRegexp.MatchString(*err.Class) {
-					if volumeDneMsgRegexp.MatchString(*err.Message) {
-						return &restError{code: RestErrorResourceDNEVolume, msg: *err.Message}
+					if match := volumeDneMsgRegexp.FindStringSubmatch(*err.Message); match != nil {
+						return &restError{code: RestErrorResourceDNEVolume, msg: *err.Message,
+							resources: []string{match[volumeDneMsgRegexp.SubexpIndex("volume")]}}
 					}
 					if targetDneMsgRegexp.MatchString(*err.Message) {
 						return &restError{code: RestErrorResourceDNETarget, msg: *err.Message}
@@ -243,7 +398,7 @@ func ErrorFromErrorT(ctx context.Context, err *ErrorT, le *logrus.Entry) *restEr
 				if len(match) > 1 {
 					msg := fmt.Sprintf("Resource %s not found", match[1])
 					l.Warnf(msg)
-					return &restError{code: RestErrorResourceDNE, msg: msg}
+					return &restError{code: RestErrorResourceDNE, msg: msg, resources: match[1:2]}
 				}
 				l.Warn("Resource not found")
 				return &restError{code: RestErrorResourceDNE, msg: *err.Message}
@@ -252,11 +407,32 @@ func ErrorFromErrorT(ctx context.Context, err *ErrorT, le *logrus.Entry) *restEr
 			}
 		}
 	}
+	// Message wording is not known, but class of exception still tells what happened
+	if err.Class != nil {
+		if itemNotFoundClassRegexp.MatchString(*err.Class) {
+			l.Warnln("Resource not found: ", err.String())
+			return &restError{code: RestErrorResourceDNE}
+		}
+		if lunItemConflictClassRegexp.MatchString(*err.Class) {
+			l.Warnln("Resource conflict: ", err.String())
+			return &restError{code: RestErrorResourceExists}
+		}
+	}
 	l.Warnln("Unable to identify error: ", err.String())
 	//l.Warnf("Errno:%d, Class:%s, Message:%s, Url:%s", *err.Errno, *err.Class, *err.Message, *err.Url )
 	return &restError{code: RestErrorFailureUnknown}
 }
 
+// datasetNames splits list of datasets from zfs error message
+func datasetNames(list string) (out []string) {
+	for _, name := range strings.Fields(list) {
+		if name = strings.Trim(name, ":"); len(name) > 0 {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
 func (err *restError) Error() (out string) {
 
 	switch (*err).code {
@@ -274,6 +450,16 @@ func (err *restError) Error() (out string) {
 		out = fmt.Sprintf("Object exists: %s", err.msg)
 	case RestErrorStorageFailureUnknown:
 		out = fmt.Sprintf("Storage failes with unknown error: %s", err.msg)
+	case RestErrorUnableToConnect:
+		out = fmt.Sprintf("Unable to connect to storage: %s", err.msg)
+	case RestErrorRequestTimeout:
+		out = fmt.Sprintf("Storage did not respond in time: %s", err.msg)
+	case RestErrorServiceUnavailable:
+		out = fmt.Sprintf("Storage is temporary unavailable: %s", err.msg)
+	case RestErrorCertificateInvalid:
+		out = fmt.Sprintf("Unable to verify storage certificate: %s", err.msg)
+	case RestErrorRequestCanceled, RestErrorDeadlineExceeded:
+		out = err.msg
 
 	default:
 		out = fmt.Sprintf("Unknown internal Error. %s", err.msg)
@@ -286,3 +472,44 @@ func (err *restError) GetCode() int {
 	return err.code
 
 }
+
+func (err *restError) Status() int {
+	return err.status
+}
+
+func (err *restError) Errno() (int, bool) {
+	if err.errno == nil {
+		return 0, false
+	}
+	return *err.errno, true
+}
+
+func (err *restError) Class() string {
+	return err.class
+}
+
+func (err *restError) Resources() []string {
+	return err.resources
+}
+
+func (err *restError) Retryable() bool {
+	switch err.code {
+	case RestErrorUnableToConnect, RestErrorRequestTimeout, RestErrorServiceUnavailable:
+		return true
+	}
+	return transientStatus(err.status)
+}
+
+// Is reports if error has the same code as target or its code is a particular case of target code
+func (err *restError) Is(target error) bool {
+	t, ok := target.(*restError)
+	if !ok {
+		return false
+	}
+	return err.code == t.code || generalCode[err.code] == t.code
+}
+
+// Unwrap gives error that caused the failure
+func (err *restError) Unwrap() error {
+	return err.cause
+}
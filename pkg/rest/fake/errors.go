@@ -0,0 +1,134 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package fake
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Classes of exceptions reported by JovianDSS
+const (
+	ClassItemNotFound        = "opene.exceptions.ItemNotFoundError"
+	ClassItemConflict        = "opene.exceptions.ItemConflictError"
+	ClassValidation          = "opene.exceptions.ValidationError"
+	ClassAuthentication      = "opene.exceptions.AuthenticationError"
+	ClassZfsCmd              = "zfslib.wrap.zfs.ZfsCmdError"
+	ClassZfsOe               = "opene.storage.zfs.ZfsOeError"
+	ClassTargetNameConflict  = "opene.san.target.base.iscsi.target.TargetNameConflictError"
+	ClassInternalServerError = "opene.exceptions.InternalServerError"
+)
+
+// Error is an error that server reports in response
+type Error struct {
+	Status  int    // HTTP status of the response
+	Class   string // class of exception, omitted if empty
+	Errno   *int   // error number, omitted if nil
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Status, e.Class, e.Message)
+}
+
+func errno(n int) *int {
+	return &n
+}
+
+func errPoolDNE(pool string) *Error {
+	return &Error{http.StatusNotFound, ClassItemNotFound, nil, fmt.Sprintf("Pool %s not found.", pool)}
+}
+
+func errVolumeDNE(pool, vpath string) *Error {
+	return &Error{http.StatusNotFound, ClassItemNotFound, nil, fmt.Sprintf("Volume %s not found in pool %s.", vpath, pool)}
+}
+
+func errParentDNE(pool, vpath string) *Error {
+	return &Error{http.StatusInternalServerError, ClassZfsCmd, errno(1),
+		fmt.Sprintf("cannot create '%s/%s': parent does not exist", pool, vpath)}
+}
+
+func errSnapshotDNE(pool, vpath, sname string) *Error {
+	return &Error{http.StatusInternalServerError, ClassZfsCmd, errno(1),
+		fmt.Sprintf("Zfs resource: %s/%s@%s not found in this collection.", pool, vpath, sname)}
+}
+
+func errSnapshotOpen(pool, vpath, sname string) *Error {
+	return &Error{http.StatusInternalServerError, ClassZfsCmd, errno(0),
+		fmt.Sprintf("cannot open '%s/%s@%s': dataset does not exist", pool, vpath, sname)}
+}
+
+func errResourceExists(pool, name string) *Error {
+	return &Error{http.StatusConflict, ClassItemConflict, errno(5), fmt.Sprintf("Resource %s/%s already exists.", pool, name)}
+}
+
+func errCloneExists(pool, vpath string) *Error {
+	return &Error{http.StatusInternalServerError, ClassZfsCmd, errno(100),
+		fmt.Sprintf("cannot create '%s/%s': dataset already exists", pool, vpath)}
+}
+
+func errVolumeHasChildren(pool, vpath string, children []string) *Error {
+	return &Error{http.StatusInternalServerError, ClassZfsCmd, errno(1000),
+		fmt.Sprintf("cannot destroy '%s/%s': volume has children\nuse '-r' to destroy the following datasets:\n%s",
+			pool, vpath, strings.Join(children, "\n"))}
+}
+
+func errSnapshotHasClones(pool, vpath, sname string, clones []string) *Error {
+	return &Error{http.StatusInternalServerError, ClassZfsCmd, errno(1000),
+		fmt.Sprintf("cannot destroy '%s/%s@%s': snapshot has dependent clones\nuse '-R' to destroy the following datasets:\n%s",
+			pool, vpath, sname, strings.Join(clones, "\n"))}
+}
+
+func errOutOfSpace(pool string, size, available int64) *Error {
+	return &Error{http.StatusInternalServerError, ClassZfsOe, nil,
+		fmt.Sprintf("New zvol size(%d) exceeds available space on pool %s(%d).", size, pool, available)}
+}
+
+func errTargetExists(pool, tname string) *Error {
+	return &Error{http.StatusConflict, ClassTargetNameConflict, nil,
+		fmt.Sprintf("Target with name %s is already present on %s.", tname, pool)}
+}
+
+func errTargetDNE(tname string) *Error {
+	return &Error{http.StatusNotFound, ClassItemNotFound, nil, fmt.Sprintf("Target %s not exists.", tname)}
+}
+
+func errVolumeUsed(pool, vpath string) *Error {
+	return &Error{http.StatusConflict, ClassItemConflict, nil, fmt.Sprintf("Volume /dev/zvol/%s/%s is already used.", pool, vpath)}
+}
+
+func errLunUsed(lun int, tname string) *Error {
+	return &Error{http.StatusConflict, ClassItemConflict, nil, fmt.Sprintf("LUN %d is already used in %s.", lun, tname)}
+}
+
+func errLunDNE(tname, vpath string) *Error {
+	return &Error{http.StatusNotFound, ClassItemNotFound, nil, fmt.Sprintf("Volume %s is not attached to target %s.", vpath, tname)}
+}
+
+func errBadRequest(format string, args ...interface{}) *Error {
+	return &Error{http.StatusBadRequest, ClassValidation, nil, fmt.Sprintf(format, args...)}
+}
+
+func errUnauthorized() *Error {
+	return &Error{http.StatusUnauthorized, ClassAuthentication, nil, "Authentication failed."}
+}
+
+func errNoRoute(method, path string) *Error {
+	return &Error{http.StatusNotFound, ClassItemNotFound, nil, fmt.Sprintf("No resource %s %s.", method, path)}
+}
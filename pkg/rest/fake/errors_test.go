@@ -0,0 +1,160 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	jcom "joviandss-kubernetescsi/pkg/common"
+	jrest "joviandss-kubernetescsi/pkg/rest"
+)
+
+const testPool = "Pool-0"
+
+func testLogger() *logrus.Entry {
+	l := logrus.New()
+	l.Out = io.Discard
+	return logrus.NewEntry(l)
+}
+
+// classify turns error of fake server into error of REST client the same way client does it for responses
+func classify(t *testing.T, e *Error) jrest.RestError {
+	t.Helper()
+
+	eb := &errorBody{Errno: e.Errno, Message: e.Message}
+	if len(e.Class) > 0 {
+		eb.Class = &e.Class
+	}
+	body, err := json.Marshal(response{Error: eb})
+	if err != nil {
+		t.Fatalf("unable to marshal error: %s", err)
+	}
+
+	var edata jrest.ErrorData
+	if err = json.Unmarshal(body, &edata); err != nil {
+		t.Fatalf("client is unable to unmarshal error %s: %s", body, err)
+	}
+	return jrest.ErrorFromErrorT(context.Background(), e.Status, &edata.Error, testLogger())
+}
+
+func TestErrorsMatchClientCodes(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      *Error
+		expected jrest.RestError
+	}{
+		{"pool not found", errPoolDNE(testPool), jrest.ErrResourceDNE},
+		{"volume not found", errVolumeDNE(testPool, "vol"), jrest.ErrResourceDNE},
+		{"snapshot not found", errSnapshotDNE(testPool, "vol", "snap"), jrest.ErrResourceDNE},
+		{"snapshot can not be opened", errSnapshotOpen(testPool, "vol", "snap"), jrest.ErrResourceDNE},
+		{"target not found", errTargetDNE("iqn.csi.2019-04:target"), jrest.ErrResourceDNE},
+		{"lun not found", errLunDNE("iqn.csi.2019-04:target", "vol"), jrest.ErrResourceDNE},
+		{"no route", errNoRoute(http.MethodGet, "/api/v3/unknown"), jrest.ErrResourceDNE},
+		{"volume exists", errResourceExists(testPool, "vol"), jrest.ErrResourceExists},
+		{"clone exists", errCloneExists(testPool, "vol"), jrest.ErrResourceExists},
+		{"target exists", errTargetExists(testPool, "iqn.csi.2019-04:target"), jrest.ErrResourceExists},
+		{"volume used", errVolumeUsed(testPool, "vol"), jrest.ErrResourceExists},
+		{"lun used", errLunUsed(0, "iqn.csi.2019-04:target"), jrest.ErrResourceExists},
+		{"volume has snapshots", errVolumeHasChildren(testPool, "vol", []string{testPool + "/vol@snap"}), jrest.ErrResourceBusy},
+		{"snapshot has clones", errSnapshotHasClones(testPool, "vol", "snap", []string{testPool + "/clone"}), jrest.ErrResourceBusy},
+		{"out of space", errOutOfSpace(testPool, 2048, 1024), jrest.ErrOutOfSpace},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rErr := classify(t, c.err)
+			if !errors.Is(rErr, c.expected) {
+				t.Errorf("fake error %q is classified by client as %d, expected %d",
+					c.err.Message, rErr.GetCode(), c.expected.GetCode())
+			}
+		})
+	}
+}
+
+func TestSpecificErrorCodes(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      *Error
+		expected int
+	}{
+		{"volume not found", errVolumeDNE(testPool, "vol"), jrest.RestErrorResourceDNEVolume},
+		{"volume has snapshots", errVolumeHasChildren(testPool, "vol", []string{testPool + "/vol@snap"}), jrest.RestErrorResourceBusyVolumeHasSnapshots},
+		{"snapshot has clones", errSnapshotHasClones(testPool, "vol", "snap", []string{testPool + "/clone"}), jrest.RestErrorResourceBusySnapshotHasClones},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if code := classify(t, c.err).GetCode(); code != c.expected {
+				t.Errorf("fake error %q is classified by client as %d, expected %d", c.err.Message, code, c.expected)
+			}
+		})
+	}
+}
+
+// TestClientGetsErrorCodes runs real client against fake server
+func TestClientGetsErrorCodes(t *testing.T) {
+	s := NewServer(testPool)
+	defer s.Close()
+
+	cfg := s.EndpointCfg()
+	var re jrest.RestEndpoint
+	if err := jrest.SetupEndpoint(&re, &cfg, testLogger()); err != nil {
+		t.Fatalf("unable to setup endpoint: %s", err)
+	}
+	ctx := jcom.WithLogger(context.Background(), testLogger())
+
+	if _, rErr := re.GetVolume(ctx, testPool, "vol"); !errors.Is(rErr, jrest.ErrResourceDNE) {
+		t.Errorf("getting missing volume gave %v, expected not found", rErr)
+	}
+
+	vol := jrest.CreateVolumeDescriptor{Name: "vol", Size: "1073741824"}
+	if rErr := re.CreateVolume(ctx, testPool, vol); rErr != nil {
+		t.Fatalf("unable to create volume: %s", rErr)
+	}
+	if rErr := re.CreateVolume(ctx, testPool, vol); !errors.Is(rErr, jrest.ErrResourceExists) {
+		t.Errorf("creating volume twice gave %v, expected exists", rErr)
+	}
+
+	if rErr := re.CreateSnapshot(ctx, testPool, "vol", &jrest.CreateSnapshotDescriptor{SnapshotName: "snap"}); rErr != nil {
+		t.Fatalf("unable to create snapshot: %s", rErr)
+	}
+	if rErr := re.DeleteVolume(ctx, testPool, "vol", jrest.DeleteVolumeDescriptor{}); jrest.ErrCode(rErr) != jrest.RestErrorResourceBusyVolumeHasSnapshots {
+		t.Errorf("deleting volume with snapshot gave %v, expected volume has snapshots", rErr)
+	}
+
+	if rErr := re.CreateClone(ctx, testPool, "vol", jrest.CloneVolumeDescriptor{Name: "clone", Snapshot: "snap"}); rErr != nil {
+		t.Fatalf("unable to create clone: %s", rErr)
+	}
+	if rErr := re.DeleteSnapshot(ctx, testPool, "vol", "snap", jrest.DeleteSnapshotDescriptor{}); jrest.ErrCode(rErr) != jrest.RestErrorResourceBusySnapshotHasClones {
+		t.Errorf("deleting snapshot with clone gave %v, expected snapshot has clones", rErr)
+	}
+
+	// Outage of the service does not tell anything about the resource
+	s.InjectFault(Fault{Path: regexp.MustCompile(`/volumes/vol$`), Error: &Error{Status: http.StatusServiceUnavailable, Message: "Service unavailable."}})
+	if _, rErr := re.GetVolume(ctx, testPool, "vol"); jrest.ErrCode(rErr) != jrest.RestErrorServiceUnavailable {
+		t.Errorf("getting volume from unavailable storage gave %v, expected service unavailable", rErr)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package fake
+
+import (
+	"regexp"
+	"time"
+)
+
+// Fault describes misbehaviour of the server for requests it matches
+//
+// Delay is applied first, then request either gets dropped, answered with Error
+// or processed as usual if neither Drop nor Error is set.
+// That allows to simulate slow storage
+type Fault struct {
+	Method string         // HTTP method of affected requests, any if empty
+	Path   *regexp.Regexp // pattern matched against request path without query, any if nil
+
+	// Number of requests affected by fault, fault is removed once they are served.
+	// Zero means that fault stays until faults are cleared
+	Times int
+
+	Delay time.Duration // time to wait before response
+	Drop  bool          // close connection without sending response
+	Error *Error        // error to respond with
+}
+
+func (f *Fault) matches(method, path string) bool {
+	if len(f.Method) > 0 && f.Method != method {
+		return false
+	}
+	return f.Path == nil || f.Path.MatchString(path)
+}
+
+// InjectFault adds fault, faults are checked in order they were added and first matching one is applied
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all injected faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// fault picks fault that have to be applied to request
+func (s *Server) fault(method, path string) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, f := range s.faults {
+		if !f.matches(method, path) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		out := *f
+		return &out
+	}
+	return nil
+}
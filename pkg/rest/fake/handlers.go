@@ -0,0 +1,454 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package fake
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// request is a parsed request to pool resources
+type request struct {
+	method string
+	query  url.Values
+	body   []byte
+
+	// path segments that follow api/v3/pools/<pool>, unescaped
+	segs []string
+}
+
+func (rq *request) decode(out interface{}) *Error {
+	if len(rq.body) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(rq.body, out); err != nil {
+		return errBadRequest("Unable to parse request body: %s", err.Error())
+	}
+	return nil
+}
+
+// match checks if request has given method and path segments, empty pattern segment matches any value
+func (rq *request) match(method string, pattern ...string) bool {
+	if rq.method != method || len(rq.segs) != len(pattern) {
+		return false
+	}
+	for i, p := range pattern {
+		if len(p) > 0 && p != rq.segs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// route passes request to handler, access to storage is serialized
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, errBadRequest("Unable to read request body: %s", err.Error()))
+		return
+	}
+
+	var segs []string
+	for _, seg := range strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/") {
+		us, err := url.PathUnescape(seg)
+		if err != nil {
+			writeError(w, r, errBadRequest("Bad path segment %s", seg))
+			return
+		}
+		segs = append(segs, us)
+	}
+
+	if len(segs) < 4 || segs[0] != "api" || segs[1] != "v3" || segs[2] != "pools" {
+		writeError(w, r, errNoRoute(r.Method, r.URL.Path))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if segs[3] != s.st.pool {
+		writeError(w, r, errPoolDNE(segs[3]))
+		return
+	}
+
+	rq := &request{method: r.Method, query: r.URL.Query(), body: body, segs: segs[4:]}
+
+	var status int
+	var data interface{}
+	var e *Error
+
+	const (
+		id      = ""
+		get     = http.MethodGet
+		post    = http.MethodPost
+		put     = http.MethodPut
+		del     = http.MethodDelete
+		vols    = "volumes"
+		snaps   = "snapshots"
+		clones  = "clones"
+		targets = "targets"
+		luns    = "luns"
+	)
+
+	switch {
+	case rq.match(get):
+		status, data = http.StatusOK, s.st.poolData()
+
+	// Volumes
+	case rq.match(get, vols):
+		status, data, e = s.listVolumes(rq)
+	case rq.match(post, vols):
+		status, data, e = s.createVolume(rq)
+	case rq.match(get, vols, snaps):
+		status, data, e = s.listAllSnapshots(rq)
+	case rq.match(get, vols, id):
+		status, data, e = s.getVolume(rq.segs[1])
+	case rq.match(del, vols, id):
+		status, data, e = s.deleteVolume(rq, rq.segs[1])
+	case rq.match(put, vols, id):
+		status, data, e = s.renameVolume(rq, rq.segs[1])
+	case rq.match(post, vols, id, "clone"):
+		status, data, e = s.createClone(rq, rq.segs[1])
+
+	// Snapshots
+	case rq.match(get, vols, id, snaps):
+		status, data, e = s.listVolumeSnapshots(rq, rq.segs[1])
+	case rq.match(post, vols, id, snaps):
+		status, data, e = s.createSnapshot(rq, rq.segs[1])
+	case rq.match(get, vols, id, snaps, id):
+		status, data, e = s.getSnapshot(rq.segs[1], rq.segs[3])
+	case rq.match(del, vols, id, snaps, id):
+		status, data, e = s.deleteSnapshot(rq.segs[1], rq.segs[3])
+	case rq.match(get, vols, id, snaps, id, clones):
+		status, data, e = s.listClones(rq.segs[1], rq.segs[3])
+	case rq.match(del, vols, id, snaps, id, clones, id):
+		status, data, e = s.deleteClone(rq, rq.segs[1], rq.segs[3], rq.segs[5])
+
+	// Targets
+	case rq.match(get, "san", "iscsi", targets):
+		status, data, e = s.listTargets()
+	case rq.match(post, "san", "iscsi", targets):
+		status, data, e = s.createTarget(rq)
+	case rq.match(get, "san", "iscsi", targets, id):
+		status, data, e = s.getTarget(rq.segs[3])
+	case rq.match(del, "san", "iscsi", targets, id):
+		status, data, e = http.StatusNoContent, nil, s.st.deleteTarget(rq.segs[3])
+	case rq.match(get, "san", "iscsi", targets, id, luns):
+		status, data, e = s.listLuns(rq.segs[3])
+	case rq.match(post, "san", "iscsi", targets, id, luns):
+		status, data, e = s.attachVolume(rq, rq.segs[3])
+	case rq.match(del, "san", "iscsi", targets, id, luns, id):
+		status, data, e = http.StatusNoContent, nil, s.st.detachVolume(rq.segs[3], rq.segs[5])
+
+	default:
+		e = errNoRoute(r.Method, r.URL.Path)
+	}
+
+	if e != nil {
+		writeError(w, r, e)
+		return
+	}
+	writeData(w, status, data)
+}
+
+// page gives entries of requested page, all entries are given if page is not specified
+//
+// Pages are counted from zero, page past the end is empty
+func (s *Server) page(rq *request, entries []interface{}) (map[string]interface{}, *Error) {
+	out := map[string]interface{}{"results": len(entries)}
+
+	ps := rq.query.Get("page")
+	if len(ps) == 0 {
+		out["entries"] = entries
+		return out, nil
+	}
+
+	page, err := strconv.Atoi(ps)
+	if err != nil || page < 0 {
+		return nil, errBadRequest("Page %s is not valid.", ps)
+	}
+
+	start := page * s.pageSize
+	if start > len(entries) {
+		start = len(entries)
+	}
+	end := start + s.pageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+	out["entries"] = entries[start:end]
+	return out, nil
+}
+
+// properties converts properties from request to strings, the same way ZFS keeps them
+func properties(in map[string]interface{}) map[string]string {
+	out := make(map[string]string)
+	for k, v := range in {
+		if v != nil {
+			out[k] = fmt.Sprint(v)
+		}
+	}
+	return out
+}
+
+///////////////////////////////////////////////////////////////////////////////
+/// Volumes
+
+func (s *Server) listVolumes(rq *request) (int, interface{}, *Error) {
+	var entries []interface{}
+	for _, v := range s.st.sortedVolumes() {
+		entries = append(entries, s.st.volumeData(v))
+	}
+	data, err := s.page(rq, entries)
+	return http.StatusOK, data, err
+}
+
+func (s *Server) getVolume(vpath string) (int, interface{}, *Error) {
+	v, err := s.st.volume(vpath)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, s.st.volumeData(v), nil
+}
+
+func (s *Server) createVolume(rq *request) (int, interface{}, *Error) {
+	var desc struct {
+		Name          string                 `json:"name"`
+		Size          string                 `json:"size"`
+		CreateParents bool                   `json:"create_parents"`
+		Sparse        bool                   `json:"sparse"`
+		Properties    map[string]interface{} `json:"properties"`
+	}
+	if err := rq.decode(&desc); err != nil {
+		return 0, nil, err
+	}
+	size, perr := strconv.ParseInt(desc.Size, 10, 64)
+	if perr != nil {
+		return 0, nil, errBadRequest("Size %s is not valid.", desc.Size)
+	}
+	if err := s.st.createVolume(desc.Name, size, desc.Sparse, desc.CreateParents, properties(desc.Properties)); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, s.st.volumeData(s.st.volumes[desc.Name]), nil
+}
+
+func (s *Server) deleteVolume(rq *request, vpath string) (int, interface{}, *Error) {
+	var desc struct {
+		RecursivelyChildren bool `json:"recursively_children"`
+	}
+	if err := rq.decode(&desc); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, s.st.deleteVolume(vpath, desc.RecursivelyChildren)
+}
+
+func (s *Server) renameVolume(rq *request, vpath string) (int, interface{}, *Error) {
+	var desc struct {
+		Name string `json:"name"`
+	}
+	if err := rq.decode(&desc); err != nil {
+		return 0, nil, err
+	}
+	if err := s.st.renameVolume(vpath, desc.Name); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, nil, nil
+}
+
+func (s *Server) createClone(rq *request, vpath string) (int, interface{}, *Error) {
+	var desc struct {
+		Name          string                 `json:"name"`
+		Snapshot      string                 `json:"snapshot"`
+		CreateParents bool                   `json:"create_parents"`
+		Properties    map[string]interface{} `json:"properties"`
+	}
+	if err := rq.decode(&desc); err != nil {
+		return 0, nil, err
+	}
+	if err := s.st.createClone(vpath, desc.Snapshot, desc.Name, desc.CreateParents, properties(desc.Properties)); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, s.st.volumeData(s.st.volumes[desc.Name]), nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+/// Snapshots
+
+func (s *Server) listAllSnapshots(rq *request) (int, interface{}, *Error) {
+	var entries []interface{}
+	for _, v := range s.st.sortedVolumes() {
+		for _, snap := range sortedSnapshots(v) {
+			entries = append(entries, s.st.snapshotShortData(snap))
+		}
+	}
+	data, err := s.page(rq, entries)
+	return http.StatusOK, data, err
+}
+
+func (s *Server) listVolumeSnapshots(rq *request, vpath string) (int, interface{}, *Error) {
+	v, err := s.st.volume(vpath)
+	if err != nil {
+		return 0, nil, err
+	}
+	var entries []interface{}
+	for _, snap := range sortedSnapshots(v) {
+		entries = append(entries, s.st.snapshotData(snap))
+	}
+	data, err := s.page(rq, entries)
+	return http.StatusOK, data, err
+}
+
+func (s *Server) getSnapshot(vpath, sname string) (int, interface{}, *Error) {
+	snap, err := s.st.snapshot(vpath, sname)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, s.st.snapshotData(snap), nil
+}
+
+func (s *Server) createSnapshot(rq *request, vpath string) (int, interface{}, *Error) {
+	var desc struct {
+		SnapshotName string                 `json:"snapshot_name"`
+		Properties   map[string]interface{} `json:"properties"`
+	}
+	if err := rq.decode(&desc); err != nil {
+		return 0, nil, err
+	}
+	if err := s.st.createSnapshot(vpath, desc.SnapshotName, properties(desc.Properties)); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, s.st.snapshotData(s.st.volumes[vpath].snapshots[desc.SnapshotName]), nil
+}
+
+func (s *Server) deleteSnapshot(vpath, sname string) (int, interface{}, *Error) {
+	return http.StatusNoContent, nil, s.st.deleteSnapshot(vpath, sname)
+}
+
+func (s *Server) listClones(vpath, sname string) (int, interface{}, *Error) {
+	snap, err := s.st.snapshot(vpath, sname)
+	if err != nil {
+		return 0, nil, err
+	}
+	entries := []interface{}{}
+	for _, name := range s.st.clonesNames(snap) {
+		c := s.st.volumes[strings.TrimPrefix(name, s.st.pool+"/")]
+		entries = append(entries, s.st.cloneData(c))
+	}
+	return http.StatusOK, entries, nil
+}
+
+func (s *Server) deleteClone(rq *request, vpath, sname, cpath string) (int, interface{}, *Error) {
+	var desc struct {
+		RecursivelyChildren bool `json:"recursively_children"`
+	}
+	if err := rq.decode(&desc); err != nil {
+		return 0, nil, err
+	}
+	snap, err := s.st.snapshot(vpath, sname)
+	if err != nil {
+		return 0, nil, err
+	}
+	c, err := s.st.volume(cpath)
+	if err != nil {
+		return 0, nil, err
+	}
+	if c.origin != snap {
+		return 0, nil, errVolumeDNE(s.st.pool, cpath)
+	}
+	return http.StatusNoContent, nil, s.st.deleteVolume(cpath, desc.RecursivelyChildren)
+}
+
+///////////////////////////////////////////////////////////////////////////////
+/// Targets
+
+func (s *Server) listTargets() (int, interface{}, *Error) {
+	var names []string
+	for name := range s.st.targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := []interface{}{}
+	for _, name := range names {
+		entries = append(entries, targetData(s.st.targets[name]))
+	}
+	return http.StatusOK, entries, nil
+}
+
+func (s *Server) getTarget(tname string) (int, interface{}, *Error) {
+	t, err := s.st.target(tname)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, targetData(t), nil
+}
+
+func (s *Server) createTarget(rq *request) (int, interface{}, *Error) {
+	var desc struct {
+		Name   string `json:"name"`
+		Active *bool  `json:"active"`
+	}
+	if err := rq.decode(&desc); err != nil {
+		return 0, nil, err
+	}
+	active := desc.Active == nil || *desc.Active
+	if err := s.st.createTarget(desc.Name, active); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, targetData(s.st.targets[desc.Name]), nil
+}
+
+func (s *Server) listLuns(tname string) (int, interface{}, *Error) {
+	t, err := s.st.target(tname)
+	if err != nil {
+		return 0, nil, err
+	}
+	var names []string
+	for name := range t.luns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := []interface{}{}
+	for _, name := range names {
+		entries = append(entries, lunData(t.luns[name]))
+	}
+	return http.StatusOK, entries, nil
+}
+
+func (s *Server) attachVolume(rq *request, tname string) (int, interface{}, *Error) {
+	var desc struct {
+		Name string `json:"name"`
+		LUN  *int   `json:"lun"`
+		Mode string `json:"mode"`
+	}
+	if err := rq.decode(&desc); err != nil {
+		return 0, nil, err
+	}
+	if err := s.st.attachVolume(tname, desc.Name, desc.LUN, desc.Mode); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, lunData(s.st.targets[tname].luns[desc.Name]), nil
+}
@@ -0,0 +1,257 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+// Package fake provides in-memory JovianDSS REST server for tests
+//
+// Server serves api/v3 pools, volumes, snapshots, clones and targets endpoints
+// that are used by rest package. It keeps ZFS semantics of volumes, snapshots and clones
+// and reports failures with the same classes, numbers and messages JovianDSS does.
+// Faults like delays, dropped connections and errors can be injected for any request
+package fake
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	jcom "joviandss-kubernetescsi/pkg/common"
+)
+
+// DefaultCapacity is a size of the pool in bytes if it was not set explicitly
+const DefaultCapacity = 1 << 40
+
+// DefaultPageSize is a number of entries given in one page of listing
+const DefaultPageSize = 50
+
+// Server is in-memory JovianDSS REST server
+type Server struct {
+	mu sync.Mutex
+
+	srv *httptest.Server
+	st  *storage
+
+	user     string
+	pass     string
+	pageSize int
+
+	faults   []*Fault
+	requests []string
+}
+
+// NewServer starts plain HTTP server with single pool
+func NewServer(pool string) *Server {
+	s := newServer(pool)
+	s.srv = httptest.NewServer(s)
+	return s
+}
+
+// NewTLSServer starts HTTPS server with single pool, server uses self signed certificate
+func NewTLSServer(pool string) *Server {
+	s := newServer(pool)
+	s.srv = httptest.NewTLSServer(s)
+	return s
+}
+
+func newServer(pool string) *Server {
+	return &Server{
+		st:       newStorage(pool, DefaultCapacity),
+		pageSize: DefaultPageSize,
+	}
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// URL gives base URL of the server
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Server gives underlying httptest server, that can be used to obtain its certificate
+func (s *Server) Server() *httptest.Server {
+	return s.srv
+}
+
+// EndpointCfg gives configuration of REST endpoint that connects to the server
+//
+// Certificate verification is disabled for TLS server
+func (s *Server) EndpointCfg() jcom.RestEndpointCfg {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	host, port, _ := net.SplitHostPort(s.srv.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	cfg := jcom.RestEndpointCfg{
+		Addrs:       []string{host},
+		Port:        p,
+		Prot:        "http",
+		User:        s.user,
+		Pass:        s.pass,
+		IdleTimeOut: "10s",
+		Tries:       1,
+	}
+	if s.srv.TLS != nil {
+		cfg.Prot = "https"
+		cfg.TLS.Insecure = true
+	}
+	return cfg
+}
+
+// SetCredentials makes server require basic authentication with given user and password
+func (s *Server) SetCredentials(user, pass string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user, s.pass = user, pass
+}
+
+// SetCapacity sets size of the pool in bytes
+func (s *Server) SetCapacity(capacity int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.st.capacity = capacity
+}
+
+// SetPageSize sets number of entries in one page of listing
+func (s *Server) SetPageSize(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pageSize = size
+}
+
+// Requests gives method and path of every request server received, in order
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// HasVolume checks if volume with path relative to pool exists
+func (s *Server) HasVolume(vpath string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.st.volumes[vpath]
+	return ok
+}
+
+// HasSnapshot checks if volume has snapshot
+func (s *Server) HasSnapshot(vpath, sname string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.st.snapshot(vpath, sname)
+	return err == nil
+}
+
+// HasTarget checks if target exists
+func (s *Server) HasTarget(tname string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.st.targets[tname]
+	return ok
+}
+
+// ServeHTTP applies injected faults and serves request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+path)
+	user, pass := s.user, s.pass
+	s.mu.Unlock()
+
+	if f := s.fault(r.Method, path); f != nil {
+		if f.Delay > 0 {
+			select {
+			case <-time.After(f.Delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if f.Drop {
+			drop(w)
+			return
+		}
+		if f.Error != nil {
+			writeError(w, r, f.Error)
+			return
+		}
+	}
+
+	if len(user) > 0 {
+		if u, p, ok := r.BasicAuth(); !ok || u != user || p != pass {
+			writeError(w, r, errUnauthorized())
+			return
+		}
+	}
+
+	s.route(w, r)
+}
+
+// drop closes connection without response
+func drop(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic(http.ErrAbortHandler)
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	conn.Close()
+}
+
+type errorBody struct {
+	Class   *string `json:"class"`
+	Errno   *int    `json:"errno"`
+	Message string  `json:"message"`
+	Url     string  `json:"url"`
+}
+
+type response struct {
+	Data  interface{} `json:"data"`
+	Error *errorBody  `json:"error"`
+}
+
+func writeData(w http.ResponseWriter, status int, data interface{}) {
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response{Data: data})
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, e *Error) {
+	eb := &errorBody{
+		Errno:   e.Errno,
+		Message: e.Message,
+		Url:     r.URL.String(),
+	}
+	if len(e.Class) > 0 {
+		eb.Class = &e.Class
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.Status)
+	json.NewEncoder(w).Encode(response{Error: eb})
+}
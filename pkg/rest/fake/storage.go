@@ -0,0 +1,494 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package fake
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// volume is a zvol, it can be placed in nested datasets and can be a clone of snapshot
+type volume struct {
+	path      string
+	size      int64
+	sparse    bool
+	created   time.Time
+	props     map[string]string
+	origin    *snapshot
+	snapshots map[string]*snapshot
+}
+
+// snapshot of a volume, volume and clones are kept as pointers so that rename does not break them
+type snapshot struct {
+	name    string
+	volume  *volume
+	created time.Time
+	props   map[string]string
+	clones  map[*volume]bool
+}
+
+type lun struct {
+	volume string
+	id     int
+	mode   string
+}
+
+type target struct {
+	name   string
+	active bool
+	luns   map[string]*lun
+}
+
+func (t *target) lunTaken(id int) bool {
+	for _, l := range t.luns {
+		if l.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// storage models pool of JovianDSS with ZFS semantics for volumes, snapshots and clones
+//
+// storage is not safe for concurrent use, server serializes access to it
+type storage struct {
+	pool     string
+	capacity int64
+
+	volumes  map[string]*volume
+	datasets map[string]bool
+	targets  map[string]*target
+}
+
+func newStorage(pool string, capacity int64) *storage {
+	return &storage{
+		pool:     pool,
+		capacity: capacity,
+		volumes:  make(map[string]*volume),
+		datasets: make(map[string]bool),
+		targets:  make(map[string]*target),
+	}
+}
+
+func (st *storage) fullName(name string) string {
+	return st.pool + "/" + name
+}
+
+func (st *storage) snapshotFullName(s *snapshot) string {
+	return fmt.Sprintf("%s/%s@%s", st.pool, s.volume.path, s.name)
+}
+
+// used gives space reserved by volumes that are not sparse
+func (st *storage) used() (out int64) {
+	for _, v := range st.volumes {
+		if !v.sparse && v.origin == nil {
+			out += v.size
+		}
+	}
+	return out
+}
+
+func (st *storage) available() int64 {
+	if av := st.capacity - st.used(); av > 0 {
+		return av
+	}
+	return 0
+}
+
+func (st *storage) volume(vpath string) (*volume, *Error) {
+	if v, ok := st.volumes[vpath]; ok {
+		return v, nil
+	}
+	return nil, errVolumeDNE(st.pool, vpath)
+}
+
+func (st *storage) snapshot(vpath, sname string) (*snapshot, *Error) {
+	v, err := st.volume(vpath)
+	if err != nil {
+		return nil, err
+	}
+	if s, ok := v.snapshots[sname]; ok {
+		return s, nil
+	}
+	return nil, errSnapshotDNE(st.pool, vpath, sname)
+}
+
+// prepareParents checks that parent datasets of the path exist, creating them if asked
+func (st *storage) prepareParents(vpath string, create bool) *Error {
+	var missing []string
+	for p := path.Dir(vpath); p != "." && p != "/"; p = path.Dir(p) {
+		if !st.datasets[p] {
+			missing = append(missing, p)
+		}
+	}
+	if len(missing) > 0 && !create {
+		return errParentDNE(st.pool, vpath)
+	}
+	for _, p := range missing {
+		st.datasets[p] = true
+	}
+	return nil
+}
+
+func (st *storage) exists(vpath string) bool {
+	_, ok := st.volumes[vpath]
+	return ok || st.datasets[vpath]
+}
+
+func (st *storage) createVolume(vpath string, size int64, sparse bool, createParents bool, props map[string]string) *Error {
+	if len(vpath) == 0 || size <= 0 {
+		return errBadRequest("Volume name and positive size have to be specified.")
+	}
+	if st.exists(vpath) {
+		return errResourceExists(st.pool, vpath)
+	}
+	if av := st.available(); !sparse && size > av {
+		return errOutOfSpace(st.pool, size, av)
+	}
+	if err := st.prepareParents(vpath, createParents); err != nil {
+		return err
+	}
+	st.volumes[vpath] = &volume{
+		path:      vpath,
+		size:      size,
+		sparse:    sparse,
+		created:   time.Now(),
+		props:     props,
+		snapshots: make(map[string]*snapshot),
+	}
+	return nil
+}
+
+func (st *storage) createSnapshot(vpath, sname string, props map[string]string) *Error {
+	v, err := st.volume(vpath)
+	if err != nil {
+		return err
+	}
+	if len(sname) == 0 {
+		return errBadRequest("Snapshot name have to be specified.")
+	}
+	if _, ok := v.snapshots[sname]; ok {
+		return errResourceExists(st.pool, vpath+"@"+sname)
+	}
+	v.snapshots[sname] = &snapshot{
+		name:    sname,
+		volume:  v,
+		created: time.Now(),
+		props:   props,
+		clones:  make(map[*volume]bool),
+	}
+	return nil
+}
+
+func (st *storage) createClone(vpath, sname, cpath string, createParents bool, props map[string]string) *Error {
+	s, err := st.snapshot(vpath, sname)
+	if err != nil {
+		return err
+	}
+	if len(cpath) == 0 {
+		return errBadRequest("Clone name have to be specified.")
+	}
+	if st.exists(cpath) {
+		return errCloneExists(st.pool, cpath)
+	}
+	if err := st.prepareParents(cpath, createParents); err != nil {
+		return err
+	}
+	c := &volume{
+		path:      cpath,
+		size:      s.volume.size,
+		sparse:    true,
+		created:   time.Now(),
+		props:     props,
+		origin:    s,
+		snapshots: make(map[string]*snapshot),
+	}
+	st.volumes[cpath] = c
+	s.clones[c] = true
+	return nil
+}
+
+// clonesNames gives sorted full names of snapshot clones
+func (st *storage) clonesNames(s *snapshot) (out []string) {
+	for c := range s.clones {
+		out = append(out, st.fullName(c.path))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// deleteSnapshot removes snapshot, snapshot that has clones can not be removed
+func (st *storage) deleteSnapshot(vpath, sname string) *Error {
+	v, err := st.volume(vpath)
+	if err != nil {
+		return err
+	}
+	s, ok := v.snapshots[sname]
+	if !ok {
+		return errSnapshotOpen(st.pool, vpath, sname)
+	}
+	if len(s.clones) > 0 {
+		return errSnapshotHasClones(st.pool, vpath, sname, st.clonesNames(s))
+	}
+	delete(v.snapshots, sname)
+	return nil
+}
+
+// deleteVolume removes volume, volume that has snapshots can be removed only recursively
+func (st *storage) deleteVolume(vpath string, recursive bool) *Error {
+	v, err := st.volume(vpath)
+	if err != nil {
+		return err
+	}
+	if len(v.snapshots) > 0 {
+		if !recursive {
+			var children []string
+			for _, s := range v.snapshots {
+				children = append(children, st.snapshotFullName(s))
+			}
+			sort.Strings(children)
+			return errVolumeHasChildren(st.pool, vpath, children)
+		}
+		for _, s := range v.snapshots {
+			if len(s.clones) > 0 {
+				return errSnapshotHasClones(st.pool, vpath, s.name, st.clonesNames(s))
+			}
+		}
+	}
+	if v.origin != nil {
+		delete(v.origin.clones, v)
+	}
+	for _, t := range st.targets {
+		delete(t.luns, vpath)
+	}
+	delete(st.volumes, vpath)
+	return nil
+}
+
+// renameVolume changes name of the volume keeping it in the same parent dataset
+func (st *storage) renameVolume(vpath, name string) *Error {
+	v, err := st.volume(vpath)
+	if err != nil {
+		return err
+	}
+	if len(name) == 0 || strings.Contains(name, "/") {
+		return errBadRequest("New name %s is not valid.", name)
+	}
+	npath := name
+	if dir := path.Dir(vpath); dir != "." {
+		npath = dir + "/" + name
+	}
+	if npath == vpath {
+		return nil
+	}
+	if st.exists(npath) {
+		return errResourceExists(st.pool, npath)
+	}
+	delete(st.volumes, vpath)
+	v.path = npath
+	st.volumes[npath] = v
+	return nil
+}
+
+func (st *storage) createTarget(name string, active bool) *Error {
+	if len(name) == 0 {
+		return errBadRequest("Target name have to be specified.")
+	}
+	if _, ok := st.targets[name]; ok {
+		return errTargetExists(st.pool, name)
+	}
+	st.targets[name] = &target{name: name, active: active, luns: make(map[string]*lun)}
+	return nil
+}
+
+func (st *storage) target(name string) (*target, *Error) {
+	if t, ok := st.targets[name]; ok {
+		return t, nil
+	}
+	return nil, errTargetDNE(name)
+}
+
+func (st *storage) deleteTarget(name string) *Error {
+	if _, err := st.target(name); err != nil {
+		return err
+	}
+	delete(st.targets, name)
+	return nil
+}
+
+func (st *storage) attachVolume(tname, vpath string, id *int, mode string) *Error {
+	t, err := st.target(tname)
+	if err != nil {
+		return err
+	}
+	if _, err := st.volume(vpath); err != nil {
+		return err
+	}
+	for _, o := range st.targets {
+		if _, ok := o.luns[vpath]; ok {
+			return errVolumeUsed(st.pool, vpath)
+		}
+	}
+
+	lid := 0
+	if id != nil {
+		lid = *id
+	} else {
+		for t.lunTaken(lid) {
+			lid++
+		}
+	}
+	if t.lunTaken(lid) {
+		return errLunUsed(lid, tname)
+	}
+	if len(mode) == 0 {
+		mode = "wt"
+	}
+	t.luns[vpath] = &lun{volume: vpath, id: lid, mode: mode}
+	return nil
+}
+
+func (st *storage) detachVolume(tname, vpath string) *Error {
+	t, err := st.target(tname)
+	if err != nil {
+		return err
+	}
+	if _, ok := t.luns[vpath]; !ok {
+		return errLunDNE(tname, vpath)
+	}
+	delete(t.luns, vpath)
+	return nil
+}
+
+///////////////////////////////////////////////////////////////////////////////
+/// Representation of resources in responses
+
+func withProps(out map[string]interface{}, props map[string]string) map[string]interface{} {
+	for k, v := range props {
+		if _, ok := out[k]; !ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func (st *storage) poolData() map[string]interface{} {
+	return map[string]interface{}{
+		"name":      st.pool,
+		"id":        st.pool,
+		"health":    "ONLINE",
+		"size":      strconv.FormatInt(st.capacity, 10),
+		"available": strconv.FormatInt(st.available(), 10),
+	}
+}
+
+func (st *storage) volumeData(v *volume) map[string]interface{} {
+	out := map[string]interface{}{
+		"name":      path.Base(v.path),
+		"full_name": st.fullName(v.path),
+		"type":      "volume",
+		"volsize":   strconv.FormatInt(v.size, 10),
+		"creation":  strconv.FormatInt(v.created.Unix(), 10),
+		"is_clone":  v.origin != nil,
+	}
+	if v.origin != nil {
+		out["origin"] = st.snapshotFullName(v.origin)
+	}
+	if v.sparse {
+		out["refreservation"] = "0"
+	} else {
+		out["refreservation"] = strconv.FormatInt(v.size, 10)
+	}
+	return withProps(out, v.props)
+}
+
+func (st *storage) snapshotData(s *snapshot) map[string]interface{} {
+	out := map[string]interface{}{
+		"name":     s.name,
+		"type":     "snapshot",
+		"creation": s.created.Format("2006-01-02 15:04:05"),
+		"volsize":  strconv.FormatInt(s.volume.size, 10),
+		"clones":   strings.Join(st.clonesNames(s), ","),
+	}
+	return withProps(out, s.props)
+}
+
+func (st *storage) snapshotShortData(s *snapshot) map[string]interface{} {
+	props := map[string]interface{}{
+		"creation":      strconv.FormatInt(s.created.Unix(), 10),
+		"resource_type": "snapshot",
+	}
+	return map[string]interface{}{
+		"volume":     s.volume.path,
+		"name":       s.name,
+		"properties": withProps(props, s.props),
+	}
+}
+
+func (st *storage) cloneData(c *volume) map[string]interface{} {
+	return map[string]interface{}{
+		"name":      c.path,
+		"full_name": st.fullName(c.path),
+		"is_clone":  "true",
+		"origin":    st.snapshotFullName(c.origin),
+	}
+}
+
+func targetData(t *target) map[string]interface{} {
+	return map[string]interface{}{
+		"name":                  t.name,
+		"active":                t.active,
+		"conflicted":            false,
+		"incoming_users_active": false,
+		"allow_ip":              []string{},
+		"deny_ip":               []string{},
+	}
+}
+
+func lunData(l *lun) map[string]interface{} {
+	return map[string]interface{}{
+		"name":       l.volume,
+		"lun":        l.id,
+		"mode":       l.mode,
+		"block_size": 512,
+		"scsi_id":    fmt.Sprintf("%016x", l.id),
+	}
+}
+
+// sortedVolumes gives volumes ordered by path, listings are stable between pages
+func (st *storage) sortedVolumes() []*volume {
+	out := make([]*volume, 0, len(st.volumes))
+	for _, v := range st.volumes {
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].path < out[j].path })
+	return out
+}
+
+func sortedSnapshots(v *volume) []*snapshot {
+	out := make([]*snapshot, 0, len(v.snapshots))
+	for _, s := range v.snapshots {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].name < out[j].name })
+	return out
+}
@@ -253,6 +253,9 @@ type DeleteVolumeData struct {
 // DeleteVolumeRCode success status code
 const DeleteVolumeRCode = 204
 
+// RenameVolumeRCode success status code
+const RenameVolumeRCode = 200
+
 ///////////////////////////////////////////////////////////////////////////////
 /// Create Snapshot
 
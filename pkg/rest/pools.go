@@ -20,10 +20,12 @@ package rest
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	log "github.com/sirupsen/logrus"
 
 	jcom "joviandss-kubernetescsi/pkg/common"
+	jmtr "joviandss-kubernetescsi/pkg/metrics"
 )
 
 func (s *RestEndpoint) GetPool(ctx context.Context, pool string) (*ResourcePool, RestError) {
@@ -54,7 +56,12 @@ func (s *RestEndpoint) GetPool(ctx context.Context, pool string) (*ResourcePool,
 	}
 
 	if stat == CodeOK || stat == CodeNoContent {
+		size, errS := strconv.ParseInt(respool.Size, 10, 64)
+		if errS != nil {
+			size = -1
+		}
+		jmtr.SetPoolCapacity(pool, size, respool.Available)
 		return &respool, nil
 	}
-	return nil, getError(ctx, body)
+	return nil, getError(ctx, stat, body)
 }
@@ -17,6 +17,10 @@ under the License.
 
 package rest
 
+import (
+	"encoding/json"
+)
+
 type Primarycache string
 
 const (
@@ -86,6 +90,18 @@ type CreateVolumeProperties struct {
 	Sync           *Sync         `json:"sync,omitempty"`
 	Dedup          *Dedup        `json:"dedup,omitempty"`
 	Copies         *Copies       `json:"copies,omitempty"`
+
+	// ZFS user properties, name of each property have to contain colon
+	User map[string]string `json:"-"`
+}
+
+func (p CreateVolumeProperties) MarshalJSON() ([]byte, error) {
+	type Alias CreateVolumeProperties
+	data, err := json.Marshal(Alias(p))
+	if err != nil {
+		return nil, err
+	}
+	return withUserProperties(data, p.User)
 }
 
 type CreateVolumeDescriptor struct {
@@ -102,6 +118,10 @@ type DeleteVolumeDescriptor struct {
 	ForceUmount         *bool `json:"force_umount,omitempty"`
 }
 
+type RenameVolumeDescriptor struct {
+	Name string `json:"name"` // new name of the volume
+}
+
 type CloneVolumeDescriptor struct {
 	Name          string                  `json:"name"`                     // string with the name that will be assigned to clone.
 	Snapshot      string                  `json:"snapshot"`                 // string name of the snapshot that clone will be created from.
@@ -113,6 +133,34 @@ type CloneVolumeDescriptor struct {
 type CreateSnapshotProperties struct {
 	Primarycache   *Primarycache `json:"primarycache,omitempty"`
 	Secondarycache *Primarycache `json:"secondarycache,omitempty"`
+
+	// ZFS user properties, name of each property have to contain colon
+	User map[string]string `json:"-"`
+}
+
+func (p CreateSnapshotProperties) MarshalJSON() ([]byte, error) {
+	type Alias CreateSnapshotProperties
+	data, err := json.Marshal(Alias(p))
+	if err != nil {
+		return nil, err
+	}
+	return withUserProperties(data, p.User)
+}
+
+// withUserProperties adds user properties to json object of properties
+func withUserProperties(data []byte, user map[string]string) ([]byte, error) {
+	if len(user) == 0 {
+		return data, nil
+	}
+
+	var props map[string]interface{}
+	if err := json.Unmarshal(data, &props); err != nil {
+		return nil, err
+	}
+	for k, v := range user {
+		props[k] = v
+	}
+	return json.Marshal(props)
 }
 
 type CreateSnapshotDescriptor struct {
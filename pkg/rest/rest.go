@@ -18,7 +18,10 @@ under the License.
 package rest
 
 import (
+	"context"
 	"fmt"
+	"sync"
+
 	"github.com/sirupsen/logrus"
 
 	jcom "joviandss-kubernetescsi/pkg/common"
@@ -28,45 +31,50 @@ var (
 	vendorVersion = "dev"
 )
 
+// StorageInterface is a set of storage operations CSI driver relies on
+//
+// RestEndpoint implements it over JovianDSS REST API, other implementations
+// may wrap it to add caching, metrics or dry-run behaviour, or substitute it completely
 type StorageInterface interface {
-
-	// General information
-	GetAddress() (string, int)
-
 	// Pools
-	GetPool() (*ResourcePool, RestError)
-	//GetPools() ([]PoolShort, error)
+	GetPool(ctx context.Context, pool string) (*ResourcePool, RestError)
 
 	// Volumes
-	CreateVolume(poolName string, vol ResourceVolume) RestError
-	GetVolume(vname string) (*ResourceVolume, RestError)
-	DeleteVolume(vname string, rSnapshots bool) RestError
-	ListVolumes(poolName string, vols *[]ResourceVolume) RestError
-
-	CreateSnapshot(vname string, sname string) RestError
-	GetSnapshot(vname string, sname string) (*ResourceSnapshot, RestError)
-	DeleteSnapshot(vname string, sname string) RestError
-	ListAllSnapshots(f func(string) bool) ([]ResourceSnapshotShort, RestError)
-	ListVolumeSnapshots(string, func(string) bool) ([]ResourceSnapshotShort, RestError)
-
-	GetTarget(tname string) (*Target, RestError)
-	CreateTarget(tname string) RestError
-	DeleteTarget(tname string) RestError
-
-	AttachToTarget(tname string, vname string, mode string) RestError
-	DettachFromTarget(tname string, vname string) RestError
-
-	AddUserToTarget(tname string, name string, pass string) RestError
-
-	CreateClone(vname string, sname string, cname string) RestError
-	//DeleteClone(vname string, sname string, cname string, rChildren bool, rDependent bool) RestError
-	PromoteClone(vname string, sname string, cname string) RestError
+	GetVolume(ctx context.Context, pool string, vname string) (*ResourceVolume, RestError)
+	CreateVolume(ctx context.Context, pool string, vol CreateVolumeDescriptor) RestError
+	DeleteVolume(ctx context.Context, pool string, vname string, data DeleteVolumeDescriptor) RestError
+	RenameVolume(ctx context.Context, pool string, vname string, data RenameVolumeDescriptor) RestError
+	GetVolumesEntries(ctx context.Context, pool string, page int64, dc int64) (*ResultEntries, RestError)
+
+	// Snapshots
+	GetVolumeSnapshot(ctx context.Context, pool string, vname string, sname string) (*ResourceSnapshot, RestError)
+	CreateSnapshot(ctx context.Context, pool string, vname string, desc *CreateSnapshotDescriptor) RestError
+	DeleteSnapshot(ctx context.Context, pool string, vname string, sname string, data DeleteSnapshotDescriptor) RestError
+	GetVolumeSnapshotsEntries(ctx context.Context, pool string, vname string, page int64, dc int64) (*ResultEntries, RestError)
+	GetSnapshotsEntries(ctx context.Context, pool string, page int64, dc int64) (*ResultEntries, RestError)
+
+	// Clones
+	GetVolumeSnapshotClones(ctx context.Context, pool string, vds string, sds string) ([]ResourceVolumeSnapshotClones, RestError)
+	CreateClone(ctx context.Context, pool string, vname string, desc CloneVolumeDescriptor) RestError
+	DeleteClone(ctx context.Context, pool string, vds string, sds string, cds string, desc DeleteVolumeDescriptor) RestError
+
+	// Targets
+	GetTarget(ctx context.Context, pool string, tname string) (*ResourceTarget, RestError)
+	ListTargets(ctx context.Context, pool string) ([]ResourceTarget, RestError)
+	GetTargetLuns(ctx context.Context, pool string, tname string) ([]ResourceTargetLun, RestError)
+	CreateTarget(ctx context.Context, pool string, desc *CreateTargetDescriptor) RestError
+	DeleteTarget(ctx context.Context, pool string, tname string) RestError
+	AttachVolumeToTarget(ctx context.Context, pool string, tname string, desc *TargetLunDescriptor) RestError
+	DettachVolumeFromTarget(ctx context.Context, pool string, tname string, vname string) RestError
 }
 
+var _ StorageInterface = (*RestEndpoint)(nil)
+
 type RestEndpoint struct {
-	rec jcom.RestEndpointCfg
-	rp  RestProxy
-	l   *logrus.Entry
+	recMu sync.RWMutex
+	rec   jcom.RestEndpointCfg
+	rp    RestProxy
+	l     *logrus.Entry
 }
 
 type StorageCfg struct {
@@ -85,6 +93,9 @@ type StorageCfg struct {
 func (re *RestEndpoint) String() string {
 	var ret string
 
+	re.recMu.RLock()
+	defer re.recMu.RUnlock()
+
 	if len(re.rec.Addrs) > 0 {
 		ret += " addres:"
 		for _, val := range re.rec.Addrs {
@@ -131,8 +142,9 @@ func SetupEndpoint(rn *RestEndpoint, cfg *jcom.RestEndpointCfg, logger *logrus.E
 
 	rn.l.Debugf("Setup rest endpoint for addresses %v", cfg.Addrs)
 
-	if ser := SetupRestProxy(&rn.rp, cfg, rn.l); ser != nil {
+	if err = SetupRestProxy(&rn.rp, cfg, rn.l); err != nil {
 		logrus.Errorf("cannot create REST client for: %v", cfg.Addrs)
+		return err
 	}
 
 	// rn.l.Debugf("RP log value %+s", rn.rp)
@@ -141,3 +153,22 @@ func SetupEndpoint(rn *RestEndpoint, cfg *jcom.RestEndpointCfg, logger *logrus.E
 	// rn.ListVolumes("Pool-0", &v)
 	return nil
 }
+
+// Close releases connections and background routines of endpoint once it is not used anymore
+func (rn *RestEndpoint) Close() {
+	rn.rp.Close()
+}
+
+// Reconfigure applies new addresses, credentials and TLS settings to endpoint,
+// endpoint keeps working with previous settings if new ones are incorrect
+func (rn *RestEndpoint) Reconfigure(cfg *jcom.RestEndpointCfg) error {
+	if err := rn.rp.Reconfigure(cfg); err != nil {
+		rn.l.Warnf("Unable to reconfigure REST endpoint: %s", err)
+		return err
+	}
+
+	rn.recMu.Lock()
+	rn.rec = *cfg
+	rn.recMu.Unlock()
+	return nil
+}
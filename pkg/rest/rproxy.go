@@ -18,14 +18,12 @@ under the License.
 package rest
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
-	httpUrl "net/url"
 	"strings"
 	"sync"
 	"time"
@@ -33,44 +31,47 @@ import (
 	"github.com/sirupsen/logrus"
 
 	jcom "joviandss-kubernetescsi/pkg/common"
+	jmtr "joviandss-kubernetescsi/pkg/metrics"
 )
 
 const sessionTimeout = 30 * time.Second
 
+const (
+	retryBaseDelay      = 500 * time.Millisecond
+	retryMaxDelay       = 8 * time.Second
+	healthCheckInterval = 15 * time.Second
+)
+
 // RestProxy - request client for any REST API
 type RestProxy struct {
-	addrs         []string
-	active_addr   int
-	port          int
-	authToken     string
-	httpRestProxy *http.Client
-	l             *logrus.Entry
-	prot          string
-	user          string
-	pass          string
-	tries         int
+	addrs       []string
+	active_addr int
+	authToken   string
+	l           *logrus.Entry
+
+	// connection properties, replaced as a whole on Reconfigure
+	conn *proxyConn
+
+	// addresses that failed to respond, those are skipped during rotation
+	down     []bool
+	checking bool
+
+	// closed once proxy is not used anymore, it stops health check
+	stop   chan struct{}
+	closed bool
 
-	mu        sync.Mutex
-	requestID int64
-	timeout   int64
+	mu      sync.Mutex
+	timeout int64
 }
 
-// restProxy - request client for any REST API
-type restProxy struct {
-	addrs         []string
-	active_addr   int
+// proxyConn describes how requests are sent to storage
+type proxyConn struct {
 	port          int
-	authToken     string
-	httpRestProxy *http.Client
-	l             *logrus.Entry
 	prot          string
 	user          string
 	pass          string
 	tries         int
-
-	mu        sync.Mutex
-	requestID int64
-	timeout   int64
+	httpRestProxy *http.Client
 }
 
 // RestProxyInterface - request client interface
@@ -79,79 +80,171 @@ type RestProxyInterface interface {
 	Send(ctx context.Context, method string, path string, data interface{}, ok int) (int, []byte, RestError)
 }
 
-func (rp *RestProxy) Send(ctx context.Context, method string, path string, data interface{}, ok int) (int, []byte, RestError) {
-	var res *http.Response
-	// var err restError
-	l := jcom.LFC(ctx)
-	l.Debugf("Path %s", path)
-	//l.Debugf("proto %+v, addr %+v, port %+v, url %+v", )
+func (rp *RestProxy) Send(ctx context.Context, method string, path string, data interface{}, ok int) (stat int, body []byte, rErr RestError) {
+	start := time.Now()
+	defer func() {
+		jmtr.ObserveREST(method, restResource(path), callCode(ctx, stat, body, rErr), time.Since(start))
+	}()
 
-	url := fmt.Sprintf("%s://%s:%d/%s", rp.prot, rp.addrs[rp.active_addr], rp.port, path)
+	if rp == nil {
+		return 0, nil, &restError{code: RestErrorUnableToConnect, msg: "REST proxy is not initialized"}
+	}
+
+	addrs, c, pl := rp.connection()
+
+	// Requests made outside of gRPC handlers might not carry logger
+	l, found := jcom.LoggerFromContext(ctx)
+	if !found {
+		l = pl
+	}
+	if l == nil {
+		l = jcom.DefaultLogger()
+	}
+	l.Debugf("Path %s", path)
 
 	l = l.WithFields(logrus.Fields{
 		"func":    "Send",
 		"section": "rest",
 		"method":  method,
-		"url":     url,
+		"path":    path,
 	})
 
-	l.Debugf("Available addrs %+v", rp.addrs)
+	l.Debugf("Available addrs %+v", addrs)
 
-	//rp.mu.Lock()
-	//rp.requestID++
-	//rp.mu.Unlock()
+	if len(addrs) == 0 {
+		return 0, nil, &restError{code: RestErrorUnableToConnect, msg: "No REST addresses configured"}
+	}
+	if c == nil || c.httpRestProxy == nil {
+		return 0, nil, &restError{code: RestErrorUnableToConnect, msg: "REST connection is not configured"}
+	}
 
 	// send request data as json
-	var reader io.Reader
+	var jdata []byte
 	if data == nil {
 		l.Debug("sending with no data")
-		reader = nil
 	} else {
-		l.Debugf("sending data %+v", data)
-		jdata, err := json.Marshal(data)
-		if err != nil {
-			return 0, nil, &restError{RestErrorRequestMalfunction, err.Error()}
+		var err error
+		if jdata, err = json.Marshal(data); err != nil {
+			return 0, nil, &restError{code: RestErrorRequestMalfunction, msg: err.Error()}
 		}
 		l.Debugf("sending marshaled data %s", jdata)
-		reader = strings.NewReader(string(jdata))
 	}
 
-	req, err := http.NewRequest(method, url, reader)
-	req.SetBasicAuth(rp.user, rp.pass)
+	tries := c.tries
+	if tries < 1 {
+		tries = 1
+	}
+
+	for attempt := 1; attempt <= tries; attempt++ {
+		if attempt > 1 {
+			delay := retryDelay(attempt - 1)
+			// There is no point to wait if request can not be completed in time
+			if dl, ok := ctx.Deadline(); ok && time.Until(dl) <= delay {
+				l.Debugf("Not enough time left to retry request")
+				return stat, body, rErr
+			}
+			l.Debugf("Retrying request in %s, attempt %d of %d", delay, attempt, tries)
+			select {
+			case <-ctx.Done():
+				return 0, nil, ContextError(ctx)
+			case <-time.After(delay):
+			}
+		}
+
+		if cErr := ContextError(ctx); cErr != nil {
+			return 0, nil, cErr
+		}
+
+		idx, addr := rp.activeAddr()
+		stat, body, rErr = rp.send(ctx, l, c, method, addr, path, jdata)
+
+		if !retriable(method, stat, rErr) {
+			return stat, body, rErr
+		}
+
+		if rErr != nil {
+			switch rErr.GetCode() {
+			case RestErrorUnableToConnect, RestErrorRequestTimeout:
+				rp.markDown(idx, addr)
+			}
+		}
+	}
+	return stat, body, rErr
+}
+
+// silentLog discards messages, it is used to classify errors that are already reported elsewhere
+var silentLog = logrus.NewEntry(&logrus.Logger{Out: io.Discard, Formatter: new(logrus.TextFormatter), Level: logrus.PanicLevel})
+
+// callCode gives REST error code of the call for metrics,
+// failures reported in response body are classified the same way callers do it but without logging
+func callCode(ctx context.Context, stat int, body []byte, rErr RestError) int {
+	if rErr != nil {
+		return rErr.GetCode()
+	}
+	if stat < http.StatusMultipleChoices {
+		return RestErrorOk
+	}
+	var edata ErrorData
+	if err := json.Unmarshal(body, &edata); err != nil {
+		return RestErrorRequestMalfunction
+	}
+	return ErrorFromErrorT(ctx, stat, &edata.Error, silentLog).GetCode()
+}
+
+// restResource turns request path into a resource kind by replacing names of pools, volumes, snapshots
+// and targets with placeholder, that keeps number of distinct metric labels bounded
+func restResource(path string) string {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	for i, seg := range segs {
+		switch seg {
+		case "api", "v3", "pools", "volumes", "snapshots", "clones", "san", "iscsi", "targets", "luns":
+		default:
+			segs[i] = ":name"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// send makes single attempt to send request to specific address
+func (rp *RestProxy) send(ctx context.Context, l *logrus.Entry, c *proxyConn, method string, addr string, path string, jdata []byte) (int, []byte, RestError) {
+	var res *http.Response
+
+	url := fmt.Sprintf("%s://%s:%d/%s", c.prot, addr, c.port, path)
+
+	l = l.WithFields(logrus.Fields{
+		"url": url,
+	})
+
+	var reader io.Reader
+	if jdata != nil {
+		reader = bytes.NewReader(jdata)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
 		//rp.l.Warnf("Unable to create req: %s", err)
-		return 0, nil, &restError{RestErrorRequestMalfunction, err.Error()}
+		return 0, nil, &restError{code: RestErrorRequestMalfunction, msg: err.Error()}
 	}
+	req.SetBasicAuth(c.user, c.pass)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("User-Agent", "Kubernetes CSI Plugin")
-	res, err = rp.httpRestProxy.Do(req)
+	if traceId := jcom.TraceID(ctx); len(traceId) > 0 {
+		req.Header.Set(jcom.RequestIDHeader, traceId)
+	}
+	res, err = c.httpRestProxy.Do(req)
 
 	if err != nil {
-		if urlErr, ok := err.(*httpUrl.Error); ok {
-			if opErr, ok := urlErr.Err.(*net.OpError); ok {
-				if dnsErr, ok := opErr.Err.(*net.DNSError); ok {
-					l.Errorln("DNS error:", dnsErr)
-					return res.StatusCode, nil, &restError{RestErrorUnableToConnect, dnsErr.Error()}
-				} else if opErr.Op == "dial" {
-					l.Errorln("Connection error:", opErr)
-					return res.StatusCode, nil, &restError{RestErrorUnableToConnect, opErr.Error()}
-				} else if netErr, ok := err.(net.Error); ok {
-					if netErr.Timeout() {
-						l.Errorln("Network error (timeout):", netErr.Error())
-						return res.StatusCode, nil, &restError{RestErrorRequestTimeout, opErr.Error()}
-					} else {
-						l.Errorln("Network error:", netErr)
-						return res.StatusCode, nil, &restError{RestErrorRequestMalfunction, opErr.Error()}
-					}
-				}
-			} else {
-				fmt.Println("Network error:", opErr)
-				return res.StatusCode, nil, &restError{RestErrorRequestMalfunction, urlErr.Error()}
-			}
-		} else {
-			fmt.Println("Unknown error:", err.Error())
-			return res.StatusCode, nil, &restError{RestErrorRequestMalfunction, err.Error()}
+		// Request was abandoned by caller, it is not an issue of the storage
+		if cErr := ContextError(ctx); cErr != nil {
+			l.Debugf("Request interrupted: %s", err.Error())
+			return 0, nil, cErr
 		}
+		rErr := networkError(err)
+		l.Errorf("Request failed: %s", rErr.Error())
+		return 0, nil, rErr
 	}
 
 	defer res.Body.Close()
@@ -159,13 +252,199 @@ func (rp *RestProxy) Send(ctx context.Context, method string, path string, data
 	// validate response body
 	bodyBytes, err := io.ReadAll(res.Body)
 	if err != nil {
-		l.Errorf("reading response failed: %s", err.Error())
-		return res.StatusCode, nil, &restError{RestErrorRequestMalfunction, "Unable to process response"}
+		if cErr := ContextError(ctx); cErr != nil {
+			return res.StatusCode, nil, cErr
+		}
+		rErr := networkError(err)
+		l.Errorf("Reading response failed: %s", rErr.Error())
+		return res.StatusCode, nil, rErr
 	}
 	l.Debugf("Request completed with code %d, obtained %d bytes", res.StatusCode, len(bodyBytes))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		l.Debugf("Response body %s", bodyBytes)
+	}
 	return res.StatusCode, bodyBytes, nil
 }
 
+// idempotent methods can be resent without risk of doing same thing twice
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retriable checks if request have to be sent again
+//
+// Request that failed to connect never reached storage, so it is safe to resend it in any case.
+// Timed out requests and requests rejected by unavailable service are resent only if they are idempotent
+func retriable(method string, stat int, err RestError) bool {
+	if err != nil {
+		switch err.GetCode() {
+		case RestErrorUnableToConnect:
+			return true
+		case RestErrorRequestTimeout:
+			return idempotent(method)
+		}
+		return false
+	}
+	return transientStatus(stat) && idempotent(method)
+}
+
+// transientStatus checks if HTTP status tells that storage is temporary unable to process requests
+func transientStatus(stat int) bool {
+	return stat == http.StatusServiceUnavailable
+}
+
+// retryDelay gives exponential backoff delay for the given retry
+func retryDelay(retry int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < retry && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	return delay
+}
+
+// connection gives addresses, connection properties and logger that are currently in use,
+// Reconfigure replaces them, so they have to be taken once per request
+func (rp *RestProxy) connection() ([]string, *proxyConn, *logrus.Entry) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return rp.addrs, rp.conn, rp.l
+}
+
+// activeAddr gives index and value of address that requests are sent to
+func (rp *RestProxy) activeAddr() (int, string) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.active_addr < 0 || rp.active_addr >= len(rp.addrs) {
+		rp.active_addr = 0
+	}
+	if len(rp.addrs) == 0 {
+		return 0, ""
+	}
+	return rp.active_addr, rp.addrs[rp.active_addr]
+}
+
+// markDown takes address out of rotation and switches active address to the next healthy one
+//
+// Health checker is started to bring address back once it recovers
+func (rp *RestProxy) markDown(idx int, addr string) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	// Addresses were replaced by Reconfigure while request was sent
+	if idx >= len(rp.addrs) || rp.addrs[idx] != addr {
+		return
+	}
+
+	if !rp.down[idx] {
+		rp.l.Warnf("Address %s is unavailable, taking it out of rotation", rp.addrs[idx])
+		rp.down[idx] = true
+	}
+
+	if rp.active_addr == idx {
+		next := (idx + 1) % len(rp.addrs)
+		for i := 1; i < len(rp.addrs); i++ {
+			if c := (idx + i) % len(rp.addrs); !rp.down[c] {
+				next = c
+				break
+			}
+		}
+		if next != idx {
+			rp.l.Infof("Switching active address from %s to %s", rp.addrs[idx], rp.addrs[next])
+		}
+		rp.active_addr = next
+	}
+
+	if !rp.checking && !rp.closed {
+		rp.checking = true
+		go rp.checkHealth()
+	}
+}
+
+// checkHealth periodically probes addresses that are out of rotation
+// and brings them back once they respond, exits when all addresses are healthy
+func (rp *RestProxy) checkHealth() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	// Let markDown start new checker if this one fails
+	defer func() {
+		if r := recover(); r != nil {
+			rp.mu.Lock()
+			rp.checking = false
+			l := rp.l
+			rp.mu.Unlock()
+			jcom.LogPanic(l, "REST health check", r)
+		}
+	}()
+
+	for {
+		select {
+		case <-rp.stop:
+			rp.mu.Lock()
+			rp.checking = false
+			rp.mu.Unlock()
+			return
+		case <-ticker.C:
+		}
+
+		down := map[int]string{}
+
+		rp.mu.Lock()
+		for i, d := range rp.down {
+			if d {
+				down[i] = rp.addrs[i]
+			}
+		}
+		if len(down) == 0 {
+			rp.checking = false
+			rp.mu.Unlock()
+			return
+		}
+		c := rp.conn
+		l := rp.l
+		rp.mu.Unlock()
+
+		for idx, addr := range down {
+			if !probe(c, l, addr) {
+				continue
+			}
+			rp.mu.Lock()
+			if idx < len(rp.addrs) && rp.addrs[idx] == addr {
+				rp.down[idx] = false
+				l.Infof("Address %s is available again, bringing it back into rotation", addr)
+			}
+			rp.mu.Unlock()
+		}
+	}
+}
+
+// probe checks if address responds to HTTP requests, any response is good enough
+func probe(c *proxyConn, l *logrus.Entry, addr string) bool {
+	url := fmt.Sprintf("%s://%s:%d/api/v3", c.prot, addr, c.port)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	req.SetBasicAuth(c.user, c.pass)
+	req.Header.Set("User-Agent", "Kubernetes CSI Plugin")
+
+	res, err := c.httpRestProxy.Do(req)
+	if err != nil {
+		l.Debugf("Address %s is still unavailable: %s", addr, err.Error())
+		return false
+	}
+	res.Body.Close()
+	return true
+}
+
 type RestProxyCfg struct {
 	Addrs       string
 	ActiveAddr  int
@@ -178,105 +457,124 @@ type RestProxyCfg struct {
 	Tries       int
 }
 
-// TODO: implement sessions
-// func NewRestProxy(cfg *RestEndpointCfg, l *logrus.Entry) (ri RestProxyInterface, err error) {
-//
-//
-// 	var timeoutDuration time.Duration
-//
-// 	le := l.WithFields(logrus.Fields{"section": "restproxy", "addrs": cfg.Addrs, "port": cfg.Port,})
-//
-// 	l.Debugf("Rest Proxy to %v", cfg.Addrs)
-//
-// 	timeoutDuration, err = time.ParseDuration(cfg.IdleTimeOut)
-//
-// 	if err != nil {
-// 		l.Warnf("Uncorrect IdleTimeOut value: %s, Error %s", cfg.IdleTimeOut, err)
-// 		return nil, err
-// 	}
-//
-// 	tr := &http.Transport{
-// 		IdleConnTimeout: sessionTimeout,
-// 		TLSClientConfig: &tls.Config{
-// 			// Connect without checking certificate
-// 			InsecureSkipVerify: true,
-// 		},
-// 	}
-//
-// 	httpRestProxy := &http.Client{
-// 		Transport: tr,
-// 		Timeout:   timeoutDuration,
-// 	}
-//
-// 	if cfg.Tries == 0 {
-// 		cfg.Tries = 3
-// 	}
-// 	ri = &RestProxy{
-// 		addrs:          cfg.Addrs,
-// 		active_addr:	0,
-// 		port:		cfg.Port,
-// 		httpRestProxy:	httpRestProxy,
-// 		l:             	le,
-// 		requestID:     	0,
-// 		prot:          	cfg.Prot,
-// 		user:          	cfg.User,
-// 		pass:          	cfg.Pass,
-// 		tries:         	cfg.Tries,
-// 	}
-//
-// 	return ri, nil
-// }
-
 func SetupRestProxy(rp *RestProxy, cfg *jcom.RestEndpointCfg, l *logrus.Entry) (err error) {
 
 	// rp.l = l.WithField("section", "restproxy")
 	rp.l = l.WithFields(logrus.Fields{"section": "restproxy", "addrs": cfg.Addrs, "port": cfg.Port})
 
 	rp.l.Debug("Setting up rest proxy")
-	var timeoutDuration time.Duration
 
-	timeoutDuration, err = time.ParseDuration(cfg.IdleTimeOut)
+	if rp.conn, err = newProxyConn(cfg, rp.l); err != nil {
+		return err
+	}
+
+	rp.addrs = append(rp.addrs, cfg.Addrs...)
+	rp.down = make([]bool, len(rp.addrs))
+	rp.active_addr = 0
+	rp.stop = make(chan struct{})
+
+	return nil
+}
+
+// Close stops health check of addresses and releases idle connections
+//
+// Requests that are being sent complete, proxy is not expected to be used afterwards
+func (rp *RestProxy) Close() {
+	rp.mu.Lock()
+	if rp.closed {
+		rp.mu.Unlock()
+		return
+	}
+	rp.closed = true
+	close(rp.stop)
+	c := rp.conn
+	rp.mu.Unlock()
+
+	if c != nil {
+		c.httpRestProxy.CloseIdleConnections()
+	}
+}
+
+// Reconfigure replaces addresses, credentials and TLS settings of proxy
+//
+// Requests that are being sent complete with previous settings.
+// If new settings are incorrect, previous ones are kept
+func (rp *RestProxy) Reconfigure(cfg *jcom.RestEndpointCfg) error {
+	if len(cfg.Addrs) == 0 {
+		return fmt.Errorf("no REST addresses provided")
+	}
 
+	_, _, pl := rp.connection()
+	if pl == nil {
+		pl = jcom.DefaultLogger()
+	}
+	l := pl.WithFields(logrus.Fields{"addrs": cfg.Addrs, "port": cfg.Port})
+	c, err := newProxyConn(cfg, l)
 	if err != nil {
-		logrus.Warnf("Uncorrect IdleTimeOut value: %s, Error %s", cfg.IdleTimeOut, err)
 		return err
 	}
 
+	rp.mu.Lock()
+	prev := rp.conn
+	var active string
+	if len(rp.addrs) > 0 {
+		active = rp.addrs[rp.active_addr]
+	}
+	rp.addrs = append([]string(nil), cfg.Addrs...)
+	rp.down = make([]bool, len(rp.addrs))
+	rp.active_addr = 0
+	// Keep sending to the same address if it is still in the list
+	for i, addr := range rp.addrs {
+		if addr == active {
+			rp.active_addr = i
+		}
+	}
+	rp.conn = c
+	rp.l = l
+	rp.mu.Unlock()
+
+	if prev != nil {
+		prev.httpRestProxy.CloseIdleConnections()
+	}
+	l.Info("REST proxy reconfigured")
+
+	return nil
+}
+
+// newProxyConn creates HTTP client and connection properties from config
+func newProxyConn(cfg *jcom.RestEndpointCfg, l *logrus.Entry) (*proxyConn, error) {
+	timeoutDuration, err := time.ParseDuration(cfg.IdleTimeOut)
+	if err != nil {
+		l.Warnf("Uncorrect IdleTimeOut value: %s, Error %s", cfg.IdleTimeOut, err)
+		return nil, err
+	}
+
 	tr := &http.Transport{
 		IdleConnTimeout: sessionTimeout,
-		TLSClientConfig: &tls.Config{
-			// Connect without checking certificate
-			InsecureSkipVerify: true,
-		},
 	}
 
-	httpRestProxy := &http.Client{
-		Transport: tr,
-		Timeout:   timeoutDuration,
+	if cfg.Prot == "https" {
+		if tr.TLSClientConfig, err = newTLSConfig(&cfg.TLS, l); err != nil {
+			l.Errorf("Unable to setup TLS: %s", err.Error())
+			return nil, err
+		}
 	}
 
-	if cfg.Tries == 0 {
-		cfg.Tries = 3
+	// Config might be shared, so default is not written back to it
+	tries := cfg.Tries
+	if tries == 0 {
+		tries = 3
 	}
-	//*rp = RestProxy{
-	//	active_addr:	0,
-	//	port:		cfg.Port,
-	//	httpRestProxy:	httpRestProxy,
-	//	requestID:     	0,
-	//	prot:          	cfg.Prot,
-	//	user:          	cfg.User,
-	//	pass:          	cfg.Pass,
-	//	tries:         	cfg.Tries,
-	//}
-	rp.addrs = append(rp.addrs, cfg.Addrs...)
-	rp.active_addr = 0
-	rp.port = cfg.Port
-	rp.httpRestProxy = httpRestProxy
-	rp.requestID = 0
-	rp.prot = cfg.Prot
-	rp.user = cfg.User
-	rp.pass = cfg.Pass
-	rp.tries = cfg.Tries
 
-	return nil
+	return &proxyConn{
+		port:  cfg.Port,
+		prot:  cfg.Prot,
+		user:  cfg.User,
+		pass:  cfg.Pass,
+		tries: tries,
+		httpRestProxy: &http.Client{
+			Transport: tr,
+			Timeout:   timeoutDuration,
+		},
+	}, nil
 }
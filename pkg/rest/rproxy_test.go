@@ -0,0 +1,336 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package rest
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	jcom "joviandss-kubernetescsi/pkg/common"
+)
+
+// unusedAddr is loopback address nobody listens on, connections to it are refused
+const unusedAddr = "127.0.0.2"
+
+func testLogger() *logrus.Entry {
+	l := logrus.New()
+	l.Out = io.Discard
+	return logrus.NewEntry(l)
+}
+
+func testContext(ctx context.Context) context.Context {
+	return jcom.WithLogger(ctx, testLogger())
+}
+
+// countingServer replies with statuses from the list, last status is repeated once list is over
+func countingServer(t *testing.T, statuses ...int) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&hits, 1))
+		if n > len(statuses) {
+			n = len(statuses)
+		}
+		w.WriteHeader(statuses[n-1])
+		w.Write([]byte("{}"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func serverPort(t *testing.T, srv *httptest.Server) (string, int) {
+	t.Helper()
+
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatalf("unable to parse server url %s: %s", srv.URL, err)
+	}
+	host, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		t.Fatalf("unable to split server address %s: %s", u.Host, err)
+	}
+	p, _ := strconv.Atoi(port)
+	return host, p
+}
+
+func testProxy(t *testing.T, prot string, port int, addrs ...string) *RestProxy {
+	t.Helper()
+
+	cfg := jcom.RestEndpointCfg{
+		Addrs:       addrs,
+		Port:        port,
+		Prot:        prot,
+		User:        "admin",
+		Pass:        "admin",
+		Tries:       3,
+		IdleTimeOut: "5s",
+	}
+	var rp RestProxy
+	if err := SetupRestProxy(&rp, &cfg, testLogger()); err != nil {
+		t.Fatalf("unable to setup proxy: %s", err)
+	}
+	return &rp
+}
+
+func TestSendRetriesUnavailableStorage(t *testing.T) {
+	srv, hits := countingServer(t, http.StatusServiceUnavailable, http.StatusOK)
+	host, port := serverPort(t, srv)
+	rp := testProxy(t, "http", port, host)
+
+	stat, _, rErr := rp.Send(testContext(context.Background()), http.MethodGet, "api/v3/pools", nil, http.StatusOK)
+	if rErr != nil {
+		t.Fatalf("request failed: %s", rErr)
+	}
+	if stat != http.StatusOK {
+		t.Errorf("got status %d, expected %d", stat, http.StatusOK)
+	}
+	if n := atomic.LoadInt32(hits); n != 2 {
+		t.Errorf("storage got %d requests, expected 2", n)
+	}
+}
+
+func TestSendDoesNotRetry(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		status int
+	}{
+		{"not found", http.MethodGet, http.StatusNotFound},
+		{"conflict", http.MethodGet, http.StatusConflict},
+		{"bad request", http.MethodDelete, http.StatusBadRequest},
+		{"internal error", http.MethodGet, http.StatusInternalServerError},
+		{"unavailable non idempotent", http.MethodPost, http.StatusServiceUnavailable},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			srv, hits := countingServer(t, c.status, http.StatusOK)
+			host, port := serverPort(t, srv)
+			rp := testProxy(t, "http", port, host)
+
+			stat, _, rErr := rp.Send(testContext(context.Background()), c.method, "api/v3/pools", nil, http.StatusOK)
+			if rErr != nil {
+				t.Fatalf("request failed: %s", rErr)
+			}
+			if stat != c.status {
+				t.Errorf("got status %d, expected %d", stat, c.status)
+			}
+			if n := atomic.LoadInt32(hits); n != 1 {
+				t.Errorf("storage got %d requests, expected 1", n)
+			}
+		})
+	}
+}
+
+func TestSendRetriesRefusedConnection(t *testing.T) {
+	srv, _ := countingServer(t, http.StatusOK)
+	_, port := serverPort(t, srv)
+	rp := testProxy(t, "http", port, unusedAddr)
+
+	start := time.Now()
+	_, _, rErr := rp.Send(testContext(context.Background()), http.MethodPost, "api/v3/pools", nil, http.StatusOK)
+	if ErrCode(rErr) != RestErrorUnableToConnect {
+		t.Fatalf("got error %v, expected unable to connect", rErr)
+	}
+	// All three tries were made, they are delayed by backoff
+	if d := time.Since(start); d < retryDelay(1)+retryDelay(2) {
+		t.Errorf("request failed after %s, retries were not made", d)
+	}
+}
+
+func TestSendFailsOverToNextAddress(t *testing.T) {
+	srv, hits := countingServer(t, http.StatusOK)
+	host, port := serverPort(t, srv)
+	rp := testProxy(t, "http", port, unusedAddr, host)
+
+	ctx := testContext(context.Background())
+	if _, _, rErr := rp.Send(ctx, http.MethodGet, "api/v3/pools", nil, http.StatusOK); rErr != nil {
+		t.Fatalf("request failed: %s", rErr)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Errorf("storage got %d requests, expected 1", n)
+	}
+
+	idx, addr := rp.activeAddr()
+	if idx != 1 || addr != host {
+		t.Errorf("active address is %d %s, expected 1 %s", idx, addr, host)
+	}
+	rp.mu.Lock()
+	down := rp.down[0]
+	rp.mu.Unlock()
+	if !down {
+		t.Errorf("refusing address is not taken out of rotation")
+	}
+
+	// Following requests go to healthy address straight away
+	start := time.Now()
+	if _, _, rErr := rp.Send(ctx, http.MethodGet, "api/v3/pools", nil, http.StatusOK); rErr != nil {
+		t.Fatalf("request failed: %s", rErr)
+	}
+	if d := time.Since(start); d >= retryBaseDelay {
+		t.Errorf("request took %s, it was not sent to active address", d)
+	}
+}
+
+func TestSendRespectsDeadline(t *testing.T) {
+	srv, hits := countingServer(t, http.StatusServiceUnavailable)
+	host, port := serverPort(t, srv)
+	rp := testProxy(t, "http", port, host)
+
+	// Deadline comes before retry would be made
+	ctx, cancel := context.WithTimeout(testContext(context.Background()), retryBaseDelay/2)
+	defer cancel()
+
+	start := time.Now()
+	stat, _, _ := rp.Send(ctx, http.MethodGet, "api/v3/pools", nil, http.StatusOK)
+	if stat != http.StatusServiceUnavailable {
+		t.Errorf("got status %d, expected %d", stat, http.StatusServiceUnavailable)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Errorf("storage got %d requests, expected 1", n)
+	}
+	if d := time.Since(start); d >= retryBaseDelay {
+		t.Errorf("request took %s, it waited for retry that would not fit deadline", d)
+	}
+}
+
+func TestSendStopsOnCancel(t *testing.T) {
+	srv, hits := countingServer(t, http.StatusServiceUnavailable)
+	host, port := serverPort(t, srv)
+	rp := testProxy(t, "http", port, host)
+
+	ctx, cancel := context.WithCancel(testContext(context.Background()))
+	time.AfterFunc(retryBaseDelay/5, cancel)
+
+	_, _, rErr := rp.Send(ctx, http.MethodGet, "api/v3/pools", nil, http.StatusOK)
+	if ErrCode(rErr) != RestErrorRequestCanceled {
+		t.Fatalf("got error %v, expected request canceled", rErr)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Errorf("storage got %d requests, expected 1", n)
+	}
+
+	// Canceled request is not sent at all
+	_, _, rErr = rp.Send(ctx, http.MethodGet, "api/v3/pools", nil, http.StatusOK)
+	if ErrCode(rErr) != RestErrorRequestCanceled {
+		t.Fatalf("got error %v, expected request canceled", rErr)
+	}
+	if n := atomic.LoadInt32(hits); n != 1 {
+		t.Errorf("storage got %d requests, expected 1", n)
+	}
+}
+
+func TestSendDoesNotRetryUnverifiedCertificate(t *testing.T) {
+	var hits int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	// Rejected handshakes are expected
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	host, port := serverPort(t, srv)
+	rp := testProxy(t, "https", port, host)
+
+	start := time.Now()
+	_, _, rErr := rp.Send(testContext(context.Background()), http.MethodGet, "api/v3/pools", nil, http.StatusOK)
+	if ErrCode(rErr) != RestErrorCertificateInvalid {
+		t.Fatalf("got error %v, expected certificate invalid", rErr)
+	}
+	if rErr.Retryable() {
+		t.Errorf("certificate error is reported as retryable")
+	}
+	if d := time.Since(start); d >= retryBaseDelay {
+		t.Errorf("request took %s, it was retried", d)
+	}
+	if n := atomic.LoadInt32(&hits); n != 0 {
+		t.Errorf("storage got %d requests, expected none", n)
+	}
+
+	rp.mu.Lock()
+	down := rp.down[0]
+	rp.mu.Unlock()
+	if down {
+		t.Errorf("address is taken out of rotation because of certificate error")
+	}
+}
+
+func TestSetupKeepsConfig(t *testing.T) {
+	cfg := jcom.RestEndpointCfg{
+		Addrs:       []string{"127.0.0.1"},
+		Port:        80,
+		Prot:        "http",
+		IdleTimeOut: "5s",
+	}
+	var rp RestProxy
+	if err := SetupRestProxy(&rp, &cfg, testLogger()); err != nil {
+		t.Fatalf("unable to setup proxy: %s", err)
+	}
+
+	if _, c, _ := rp.connection(); c.tries != 3 {
+		t.Errorf("proxy makes %d tries, expected default 3", c.tries)
+	}
+	if cfg.Tries != 0 {
+		t.Errorf("default number of tries is written to shared config")
+	}
+}
+
+func TestCloseStopsHealthCheck(t *testing.T) {
+	srv, _ := countingServer(t, http.StatusOK)
+	host, port := serverPort(t, srv)
+	rp := testProxy(t, "http", port, unusedAddr, host)
+
+	// Refusing address is checked in background till it responds
+	if _, _, rErr := rp.Send(testContext(context.Background()), http.MethodGet, "api/v3/pools", nil, http.StatusOK); rErr != nil {
+		t.Fatalf("request failed: %s", rErr)
+	}
+	rp.mu.Lock()
+	checking := rp.checking
+	rp.mu.Unlock()
+	if !checking {
+		t.Fatalf("health check is not started")
+	}
+
+	rp.Close()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(time.Millisecond) {
+		rp.mu.Lock()
+		checking = rp.checking
+		rp.mu.Unlock()
+		if !checking {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("health check is running after proxy is closed")
+		}
+	}
+	// Closing twice is harmless
+	rp.Close()
+}
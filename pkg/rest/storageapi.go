@@ -21,6 +21,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	//"reflect"
 	//"strconv"
 	//"strings"
@@ -33,13 +34,19 @@ import (
 	jcom "joviandss-kubernetescsi/pkg/common"
 )
 
+// volumePath escapes volume path, so that volume placed in nested datasets
+// is addressed as a single element of REST path
+func volumePath(vname string) string {
+	return url.PathEscape(vname)
+}
+
 type SnapshotDescriptor struct {
 	VName   string
 	SName   string
 	Created string
 }
 
-func getError(ctx context.Context, body []byte) RestError {
+func getError(ctx context.Context, stat int, body []byte) RestError {
 
 	l := jcom.LFC(ctx)
 
@@ -52,10 +59,10 @@ func getError(ctx context.Context, body []byte) RestError {
 		bs := fmt.Sprintf(string(body[:len(body)]))
 		msg := fmt.Sprintf("Unable to extract json output from error message: %s", bs)
 		l.Warnf(msg)
-		return &restError{RestErrorRequestMalfunction, msg}
+		return &restError{code: RestErrorRequestMalfunction, msg: msg, status: stat}
 	} else {
 
-		return ErrorFromErrorT(ctx, &edata.Error, l)
+		return ErrorFromErrorT(ctx, stat, &edata.Error, l)
 	}
 }
 
@@ -70,6 +77,8 @@ func (re *RestEndpoint) unmarshal(resp []byte, ret interface{}) RestError {
 }
 
 func (re *RestEndpoint) GetAddress() (string, int) {
+	re.recMu.RLock()
+	defer re.recMu.RUnlock()
 	return re.rec.Addrs[0], re.rec.Port
 }
 
@@ -81,12 +90,12 @@ func (s *RestEndpoint) GetVolume(ctx context.Context, pool string, vname string)
 	var resvol ResourceVolume
 	var rsp = GeneralResponse{Data: &resvol}
 
-	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s", pool, vname)
+	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s", pool, volumePath(vname))
 
 	l := s.l.WithFields(log.Fields{
-		"func":    "GetVolume",
-		"traceId": ctx.Value("traceId"),
-		"url":     addr,
+		"func":            "GetVolume",
+		jcom.FieldTraceID: jcom.TraceID(ctx),
+		"url":             addr,
 	})
 
 	stat, body, err := s.rp.Send(ctx, "GET", addr, nil, GetVolumeRCode)
@@ -105,7 +114,7 @@ func (s *RestEndpoint) GetVolume(ctx context.Context, pool string, vname string)
 		return &resvol, nil
 	}
 
-	return nil, getError(ctx, body)
+	return nil, getError(ctx, stat, body)
 }
 
 func (s *RestEndpoint) CreateVolume(ctx context.Context, pool string, vol CreateVolumeDescriptor) RestError {
@@ -114,9 +123,9 @@ func (s *RestEndpoint) CreateVolume(ctx context.Context, pool string, vol Create
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(log.Fields{
-		"func":    "CreateVolume",
-		"traceId": ctx.Value("traceId"),
-		"url":     addr,
+		"func":            "CreateVolume",
+		jcom.FieldTraceID: jcom.TraceID(ctx),
+		"url":             addr,
 	})
 
 	l.Debugf("sending to pool %s", pool)
@@ -138,7 +147,7 @@ func (s *RestEndpoint) CreateVolume(ctx context.Context, pool string, vol Create
 	// TODO: consider case when volume is in process of creation, and not finished yet
 	// should we check if it was created successfully
 
-	return getError(ctx, body)
+	return getError(ctx, stat, body)
 }
 
 // DeleteVolume delete volume, fails if it has snapshots
@@ -146,7 +155,7 @@ func (s *RestEndpoint) CreateVolume(ctx context.Context, pool string, vol Create
 // set rSnapshots to true in order to delete snapshots
 func (s *RestEndpoint) DeleteVolume(ctx context.Context, pool string, vname string, data DeleteVolumeDescriptor) RestError {
 
-	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s", pool, vname)
+	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s", pool, volumePath(vname))
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(log.Fields{
@@ -168,7 +177,35 @@ func (s *RestEndpoint) DeleteVolume(ctx context.Context, pool string, vname stri
 		return nil
 	}
 
-	return getError(ctx, body)
+	return getError(ctx, stat, body)
+}
+
+// RenameVolume changes name of the volume
+func (s *RestEndpoint) RenameVolume(ctx context.Context, pool string, vname string, data RenameVolumeDescriptor) RestError {
+
+	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s", pool, volumePath(vname))
+
+	l := jcom.LFC(ctx)
+	l = l.WithFields(log.Fields{
+		"func":    "RenameVolume",
+		"url":     addr,
+		"section": "rest",
+	})
+
+	l.Debugf("Renaming volume %s to %s", vname, data.Name)
+
+	stat, body, err := s.rp.Send(ctx, "PUT", addr, data, RenameVolumeRCode)
+
+	if err != nil {
+		s.l.Warnln("Unable to rename volume: ", vname)
+		return err
+	}
+
+	if stat == CodeOK || stat == CodeNoContent {
+		return nil
+	}
+
+	return getError(ctx, stat, body)
 }
 
 func (s *RestEndpoint) ListVolumes(ctx context.Context, pool string, vols *[]ResourceVolume) RestError {
@@ -176,8 +213,8 @@ func (s *RestEndpoint) ListVolumes(ctx context.Context, pool string, vols *[]Res
 	addr := fmt.Sprintf("api/v3/pools/%s/volumes", pool)
 
 	l := s.l.WithFields(log.Fields{
-		"func":    "ListVolumes",
-		"traceId": ctx.Value("traceId"),
+		"func":            "ListVolumes",
+		jcom.FieldTraceID: jcom.TraceID(ctx),
 	})
 
 	l.Debug("Listing volumes")
@@ -195,13 +232,13 @@ func (s *RestEndpoint) ListVolumes(ctx context.Context, pool string, vols *[]Res
 		return s.unmarshal(body, &rsp)
 	}
 
-	return getError(ctx, body)
+	return getError(ctx, stat, body)
 }
 
 // GetVolumeSnapshot provides information about specific volume snapshot requested
 func (s *RestEndpoint) GetVolumeSnapshot(ctx context.Context, pool string, vname string, sname string) (sdp *ResourceSnapshot, err RestError) {
 
-	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/snapshots/%s", pool, vname, sname)
+	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/snapshots/%s", pool, volumePath(vname), sname)
 
 	l := jcom.LFC(ctx)
 
@@ -229,7 +266,7 @@ func (s *RestEndpoint) GetVolumeSnapshot(ctx context.Context, pool string, vname
 		return &snapdata, nil
 	}
 
-	return nil, getError(ctx, body)
+	return nil, getError(ctx, stat, body)
 }
 
 // # Create Snapshot from existing volumes
@@ -242,7 +279,7 @@ func (s *RestEndpoint) GetVolumeSnapshot(ctx context.Context, pool string, vname
 //   - *desc* data, including snapahot name, that would be transfered to create snapshot
 func (s *RestEndpoint) CreateSnapshot(ctx context.Context, pool string, vid string, desc *CreateSnapshotDescriptor) RestError {
 
-	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/snapshots", pool, vid)
+	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/snapshots", pool, volumePath(vid))
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(log.Fields{
@@ -261,14 +298,14 @@ func (s *RestEndpoint) CreateSnapshot(ctx context.Context, pool string, vid stri
 		return nil
 	}
 
-	return getError(ctx, body)
+	return getError(ctx, stat, body)
 }
 
 func (s *RestEndpoint) DeleteSnapshot(ctx context.Context, pool string, vname string, sname string, data DeleteSnapshotDescriptor) (err RestError) {
 
 	l := jcom.LFC(ctx)
 
-	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/snapshots/%s", pool, vname, sname)
+	addr := fmt.Sprintf("api/v3/pools/%s/volumes/%s/snapshots/%s", pool, volumePath(vname), sname)
 
 	l = l.WithFields(log.Fields{
 		"func": "DeleteSnapshot",
@@ -287,7 +324,7 @@ func (s *RestEndpoint) DeleteSnapshot(ctx context.Context, pool string, vname st
 		return nil
 	}
 
-	return getError(ctx, body)
+	return getError(ctx, stat, body)
 }
 
 func (s *RestEndpoint) getResultsEntries(data *GeneralResponse) (results *int64, entries interface{}) {
@@ -59,7 +59,81 @@ func (s *RestEndpoint) GetTarget(ctx context.Context, pool string, tname string)
 		return &resTarget, nil
 	}
 
-	return nil, getError(ctx, body)
+	return nil, getError(ctx, stat, body)
+}
+
+// ListTargets provides list of iscsi targets present on pool
+func (s *RestEndpoint) ListTargets(ctx context.Context, pool string) ([]ResourceTarget, RestError) {
+
+	addr := fmt.Sprintf("api/v3/pools/%s/san/iscsi/targets", pool)
+
+	l := jcom.LFC(ctx)
+	l = l.WithFields(log.Fields{
+		"url":     addr,
+		"section": "rest",
+		"func":    "ListTargets",
+	})
+
+	var targets []ResourceTarget
+	var rsp = GeneralResponse{Data: &targets}
+
+	l.Debugf("Listing targets of pool %s", pool)
+	stat, body, err := s.rp.Send(ctx, "GET", addr, nil, CodeOK)
+
+	if err != nil {
+		l.Warnf("Unable to list targets because of %s", err.Error())
+		return nil, err
+	}
+
+	if errU := s.unmarshal(body, &rsp); errU != nil {
+		return nil, errU
+	}
+
+	if stat == CodeOK {
+		return targets, nil
+	}
+
+	return nil, getError(ctx, stat, body)
+}
+
+// GetTargetLuns provides list of volumes attached to target
+func (s *RestEndpoint) GetTargetLuns(ctx context.Context, pool string, tname string) ([]ResourceTargetLun, RestError) {
+
+	addr := fmt.Sprintf("api/v3/pools/%s/san/iscsi/targets/%s/luns", pool, tname)
+
+	l := jcom.LFC(ctx)
+	l = l.WithFields(log.Fields{
+		"url":     addr,
+		"section": "rest",
+		"func":    "GetTargetLuns",
+	})
+
+	var luns []ResourceTargetLun
+	var rsp = GeneralResponse{Data: &luns}
+
+	l.Debugf("Getting luns of target %s", tname)
+	stat, body, err := s.rp.Send(ctx, "GET", addr, nil, CodeOK)
+
+	if stat == 404 {
+		msg := fmt.Sprintf("Target do not exists %s", tname)
+		l.Debug(msg)
+		return nil, GetError(RestErrorResourceDNETarget, msg)
+	}
+
+	if err != nil {
+		l.Warnf("Unable to get luns of target %s because of %s", tname, err.Error())
+		return nil, err
+	}
+
+	if errU := s.unmarshal(body, &rsp); errU != nil {
+		return nil, errU
+	}
+
+	if stat == CodeOK {
+		return luns, nil
+	}
+
+	return nil, getError(ctx, stat, body)
 }
 
 func (s *RestEndpoint) CreateTarget(ctx context.Context, pool string, desc *CreateTargetDescriptor) RestError {
@@ -96,7 +170,7 @@ func (s *RestEndpoint) CreateTarget(ctx context.Context, pool string, desc *Crea
 		}
 		return rErr
 	}
-	return getError(ctx, body)
+	return getError(ctx, stat, body)
 }
 
 func (s *RestEndpoint) DeleteTarget(ctx context.Context, pool string, tname string) RestError {
@@ -128,7 +202,7 @@ func (s *RestEndpoint) DeleteTarget(ctx context.Context, pool string, tname stri
 		return nil
 	}
 
-	return getError(ctx, body)
+	return getError(ctx, stat, body)
 }
 
 func (s *RestEndpoint) AttachVolumeToTarget(ctx context.Context, pool string, tname string, desc *TargetLunDescriptor) (err RestError) {
@@ -148,7 +222,7 @@ func (s *RestEndpoint) AttachVolumeToTarget(ctx context.Context, pool string, tn
 	if stat == 404 {
 		msg := fmt.Sprintf("Target do not exists %s", tname)
 		l.Debugf(msg)
-		return getError(ctx, body)
+		return getError(ctx, stat, body)
 	}
 
 	if err != nil {
@@ -161,12 +235,12 @@ func (s *RestEndpoint) AttachVolumeToTarget(ctx context.Context, pool string, tn
 		return nil
 	}
 
-	return getError(ctx, body)
+	return getError(ctx, stat, body)
 }
 
 func (s *RestEndpoint) DettachVolumeFromTarget(ctx context.Context, pool string, tname string, vname string) RestError {
 
-	addr := fmt.Sprintf("api/v3/pools/%s/san/iscsi/targets/%s/luns/%s", pool, tname, vname)
+	addr := fmt.Sprintf("api/v3/pools/%s/san/iscsi/targets/%s/luns/%s", pool, tname, volumePath(vname))
 
 	l := jcom.LFC(ctx)
 	l = l.WithFields(log.Fields{
@@ -195,7 +269,7 @@ func (s *RestEndpoint) DettachVolumeFromTarget(ctx context.Context, pool string,
 		return nil
 	}
 	// TODO: provide erroro handling for various cases
-	return getError(ctx, body)
+	return getError(ctx, stat, body)
 }
 
 func (s *RestEndpoint) AddUserToTarget(tname string,
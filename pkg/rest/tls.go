@@ -0,0 +1,99 @@
+/*
+Copyright (c) 2024 Open-E, Inc.
+All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License"); you may
+not use this file except in compliance with the License. You may obtain
+a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+License for the specific language governing permissions and limitations
+under the License.
+*/
+
+package rest
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	jcom "joviandss-kubernetescsi/pkg/common"
+)
+
+const spkiPinPrefix = "sha256/"
+
+var errSPKIPinMismatch = errors.New("certificate does not match configured SPKI pins")
+
+// newTLSConfig creates TLS config for connections to JovianDSS REST endpoint
+//
+// Server certificate is verified against system roots or CA bundle from config,
+// verification can be disabled only explicitly.
+// If SPKI pins are given, one of certificates in the chain have to match one of them
+func newTLSConfig(cfg *jcom.RestTLSCfg, l *logrus.Entry) (*tls.Config, error) {
+
+	tc := &tls.Config{
+		ServerName: cfg.ServerName,
+	}
+
+	if len(cfg.CABundle) > 0 {
+		pem, err := os.ReadFile(cfg.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle %s: %s", cfg.CABundle, err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s does not contain any PEM encoded certificate", cfg.CABundle)
+		}
+		tc.RootCAs = pool
+	}
+
+	if len(cfg.ClientCert) > 0 || len(cfg.ClientKey) > 0 {
+		if len(cfg.ClientCert) == 0 || len(cfg.ClientKey) == 0 {
+			return nil, fmt.Errorf("both client certificate and client key have to be provided")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate %s: %s", cfg.ClientCert, err.Error())
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(cfg.Pins) > 0 {
+		pins := make(map[string]bool)
+		for _, p := range cfg.Pins {
+			pin := strings.TrimPrefix(strings.TrimSpace(p), spkiPinPrefix)
+			if raw, err := base64.StdEncoding.DecodeString(pin); err != nil || len(raw) != sha256.Size {
+				return nil, fmt.Errorf("SPKI pin %s is not a base64 encoded sha256 hash", p)
+			}
+			pins[pin] = true
+		}
+		tc.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, cert := range cs.PeerCertificates {
+				hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				if pins[base64.StdEncoding.EncodeToString(hash[:])] {
+					return nil
+				}
+			}
+			return fmt.Errorf("%s: %w", cs.ServerName, errSPKIPinMismatch)
+		}
+	}
+
+	if cfg.Insecure {
+		l.Warn("Certificate verification of JovianDSS REST endpoint is disabled, connection is vulnerable to man-in-the-middle attacks")
+		tc.InsecureSkipVerify = true
+	}
+
+	return tc, nil
+}
@@ -21,12 +21,13 @@ import (
 	"encoding/json"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
 const resourceNamePattern = `/([\w\-\/]+)`
 
-const originNamePattern = `(?P<pool>[\w\-\.]+)/(?P<volume>[\w\-\.]+)@(?P<snapshot>[\w\-\.]+)`
+const originNamePattern = `(?P<pool>[\w\-\.]+)/(?P<volume>[\w\-\./]+)@(?P<snapshot>[\w\-\.]+)`
 
 var resourceNameRegexp = regexp.MustCompile(resourceNamePattern)
 var originNameRegexp = regexp.MustCompile(originNamePattern)
@@ -128,6 +129,39 @@ type ResourceVolume struct {
 	Context              string `json:"context,omitempty"`
 	Zoned                string `json:"zoned,omitempty"`
 	NBMAND               string `json:"nbmand,omitempty"`
+
+	UserProperties map[string]string `json:"-"`
+}
+
+func (v *ResourceVolume) UnmarshalJSON(data []byte) (err error) {
+
+	type Alias ResourceVolume
+	if err = json.Unmarshal(data, (*Alias)(v)); err != nil {
+		return err
+	}
+	v.UserProperties, err = userProperties(data)
+	return err
+}
+
+// userProperties extracts ZFS user properties, those are properties with colon in name
+func userProperties(data []byte) (out map[string]string, err error) {
+	var props map[string]interface{}
+	if err = json.Unmarshal(data, &props); err != nil {
+		return nil, err
+	}
+
+	for k, v := range props {
+		if !strings.Contains(k, ":") {
+			continue
+		}
+		if sv, ok := v.(string); ok {
+			if out == nil {
+				out = make(map[string]string)
+			}
+			out[k] = sv
+		}
+	}
+	return out, nil
 }
 
 func (v *ResourceVolume) GetSize() int64 {
@@ -138,6 +172,15 @@ func (v *ResourceVolume) GetSize() int64 {
 	}
 }
 
+// Path gives volume path relative to pool, that includes parent datasets if there are any
+func (v *ResourceVolume) Path() string {
+	if parts := strings.SplitN(v.FullName, "/", 2); len(parts) == 2 && len(parts[1]) > 0 {
+		return parts[1]
+	}
+	return v.Name
+}
+
+// OriginVolume gives path of origin volume relative to pool
 func (v *ResourceVolume) OriginVolume() string {
 	if len(v.Origin) > 0 {
 		if originNameRegexp.MatchString(v.Origin) {
@@ -186,6 +229,8 @@ type ResourceSnapshot struct {
 	LogicalReferenced string    `json:"logicalreferenced,omitempty"`
 	Context           string    `json:"context,omitempty"`
 	Clones            string    `json:"clones,omitempty"`
+
+	UserProperties map[string]string `json:"-"`
 }
 
 func (m *ResourceSnapshot) UnmarshalJSON(data []byte) error {
@@ -218,6 +263,12 @@ func (m *ResourceSnapshot) UnmarshalJSON(data []byte) error {
 		m.VolSize = parsedVolSize
 	}
 
+	up, err := userProperties(data)
+	if err != nil {
+		return err
+	}
+	m.UserProperties = up
+
 	return nil
 }
 
@@ -239,6 +290,8 @@ func (s *ResourceSnapshot) GetSize() int64 {
 type ResourceSnapshotShortProperties struct {
 	Creation     time.Time `json:"creation,omitempty"`
 	ResourceType string    `json:"resource_type,omitempty"`
+
+	UserProperties map[string]string `json:"-"`
 }
 
 func (m *ResourceSnapshotShortProperties) UnmarshalJSON(data []byte) error {
@@ -262,6 +315,8 @@ func (m *ResourceSnapshotShortProperties) UnmarshalJSON(data []byte) error {
 		m.Creation = time.Unix(creationTime, 0)
 	}
 
+	m.UserProperties, _ = userProperties(data)
+
 	return nil
 }
 
@@ -383,3 +438,12 @@ type ResourceTarget struct {
 	AllowIP             []string                  `json:"allow_ip,omitempty"`
 	DenyIP              []string                  `json:"deny_ip,omitempty"`
 }
+
+type ResourceTargetLun struct {
+	Name      string `json:"name,omitempty"`
+	SCSIID    string `json:"scsi_id,omitempty"`
+	LUN       int    `json:"lun,omitempty"`
+	Mode      string `json:"mode,omitempty"`
+	BlockSize int    `json:"block_size,omitempty"`
+	EUI       string `json:"eui,omitempty"`
+}